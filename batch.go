@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	pb "greateapot.re/dblabs-api"
+)
+
+type batchStep struct {
+	query string
+	args  []any
+}
+
+// batchOperationQueryBuilder is operationQueryBuilder which rejects row returning operations.
+func batchOperationQueryBuilder(operation *pb.Operation) (query string, args []any, err error) {
+	switch operation.GetType() {
+	case pb.OperationType_SELECT, pb.OperationType_JOIN, pb.OperationType_SHOW_DATABASES, pb.OperationType_SHOW_TABLES, pb.OperationType_SHOW_TABLE_STRUCT:
+		return failBuildQuery("operation type %s isn't allowed in batch", operation.GetType().String())
+	default:
+		return operationQueryBuilder(operation)
+	}
+}
+
+// batchSavepoint lets a batch inside client transaction undo only its own steps.
+const batchSavepoint = "dblabs_batch"
+
+// errBatchNotRolledBack: rollback to savepoint failed, it's gone once DDL step commits implicitly.
+var errBatchNotRolledBack = errors.New("failed to rollback to savepoint, steps before the failed one stay applied")
+
+// execBatch runs steps in order on one tx, the first failing one stops the batch and rolls back
+// (to savepoint, if running in client transaction). Note: mysql commits implicitly on DDL, so only
+// DML after the last DDL step is rolled back.
+func (s *ApiServer) execBatch(ctx context.Context, transaction_id string, database_name string, session_state bool, steps []batchStep) (results []*pb.OkResponse, failed_step int, err error) {
+	failed_step = -1
+	err = s.inSessionTx(ctx, transaction_id, database_name, session_state, func(tx *sql.Tx) error {
+		if transaction_id != "" {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT "+batchSavepoint); err != nil {
+				return fmt.Errorf("failed to set savepoint, err: %w", err)
+			}
+		}
+		for i, step := range steps {
+			if SrvConf.LogQueries {
+				log.Printf("Executing batch step %d query: %s; args: %v", i, step.query, step.args)
+			}
+			if result, err := execTx(ctx, tx, step.query, step.args...); err != nil {
+				failed_step = i
+				if transaction_id != "" {
+					if _, rollback_err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+batchSavepoint); rollback_err != nil {
+						return fmt.Errorf("step %d: %w; %w, err: %s", i, err, errBatchNotRolledBack, rollback_err.Error())
+					}
+				}
+				return fmt.Errorf("step %d: %w", i, err)
+			} else {
+				results = append(results, result)
+			}
+		}
+		return nil
+	})
+	return results, failed_step, err
+}
+
+// Batch error statuses carry BatchResponse detail (besides ErrorInfo with "failed_step" in metadata):
+// FailedStep is index of the failed operation (-1 if no step failed, e.g. on commit), Results are
+// of the steps completed before it, which were rolled back (except for implicitly committed DDL).
+// In client transaction, "rolled_back" metadata is "false" if rollback to savepoint failed, and
+// those steps stay applied. Successful BatchResponse has FailedStep -1.
+
+// batchBuildErrorStatus is buildErrorStatus pointing at the failed operation.
+func batchBuildErrorStatus(step int, err error) error {
+	return withStatusDetails(
+		errorStatus(
+			errorClass{reasonInvalidRequest, codes.InvalidArgument, false},
+			fmt.Sprintf("step %d: %s", step, err.Error()),
+			map[string]string{"failed_step": strconv.Itoa(step)},
+			&errdetails.BadRequest_FieldViolation{Field: fmt.Sprintf("operations[%d]", step), Description: err.Error()},
+		),
+		&pb.BatchResponse{Ok: false, FailedStep: int32(step)},
+	)
+}
+
+// batchExecErrorStatus is execErrorStatus with failed step index in metadata and results of completed steps.
+func batchExecErrorStatus(failed_step int, results []*pb.OkResponse, err error) error {
+	class, metadata := classifyExecError(err)
+	metadata["failed_step"] = strconv.Itoa(failed_step)
+	if errors.Is(err, errBatchNotRolledBack) {
+		metadata["rolled_back"] = "false"
+	}
+	return withStatusDetails(
+		errorStatus(class, err.Error(), metadata),
+		&pb.BatchResponse{Ok: false, FailedStep: int32(failed_step), Results: results},
+	)
+}
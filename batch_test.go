@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	pb "greateapot.re/dblabs-api"
+)
+
+func errorInfoMetadata(err error) map[string]string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetMetadata()
+		}
+	}
+	return nil
+}
+
+func deleteOperation(table_name string) *pb.Operation {
+	return &pb.Operation{Type: pb.OperationType_DELETE, Delete: &pb.DeleteRequest{TableName: table_name}}
+}
+
+func TestBatchImplicitTransaction(t *testing.T) {
+	s, mock := newMockServer(t)
+	request := &pb.BatchRequest{Operations: []*pb.Operation{deleteOperation("users"), deleteOperation("orders")}}
+
+	mock.ExpectBegin()
+	mockExec(mock, "DELETE FROM `users`")
+	mockExec(mock, "DELETE FROM `orders`")
+	mock.ExpectCommit()
+	if response, err := s.Batch(context.Background(), request); err != nil {
+		t.Fatalf("Batch: %s", err)
+	} else if !response.GetOk() || response.GetFailedStep() != -1 || len(response.GetResults()) != 2 {
+		t.Errorf("Batch = %v", response)
+	}
+
+	mock.ExpectBegin()
+	mockExec(mock, "DELETE FROM `users`")
+	mock.ExpectExec("DELETE FROM `orders`").WillReturnError(errors.New("table is locked"))
+	mock.ExpectRollback()
+	_, err := s.Batch(context.Background(), request)
+	if metadata := errorInfoMetadata(err); metadata["failed_step"] != "1" || metadata["rolled_back"] != "" {
+		t.Errorf("Batch = %v, metadata %v", err, metadata)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBatchSavepoint(t *testing.T) {
+	for _, rollback_fails := range []bool{false, true} {
+		s, mock := newMockServer(t)
+		mock.ExpectBegin()
+		transaction_id, err := s.Transactions.begin(context.Background(), false, "")
+		if err != nil {
+			t.Fatalf("begin: %s", err)
+		}
+		request := &pb.BatchRequest{TransactionId: transaction_id, Operations: []*pb.Operation{deleteOperation("users"), deleteOperation("orders")}}
+
+		mock.ExpectExec("SAVEPOINT dblabs_batch").WillReturnResult(sqlmock.NewResult(0, 0))
+		mockExec(mock, "DELETE FROM `users`")
+		mock.ExpectExec("DELETE FROM `orders`").WillReturnError(errors.New("table is locked"))
+		if rollback_fails {
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT dblabs_batch").WillReturnError(errors.New("SAVEPOINT dblabs_batch does not exist"))
+		} else {
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT dblabs_batch").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		_, err = s.Batch(context.Background(), request)
+		metadata := errorInfoMetadata(err)
+		if metadata["failed_step"] != "1" {
+			t.Errorf("Batch = %v, metadata %v", err, metadata)
+		} else if rollback_fails && (metadata["rolled_back"] != "false" || !strings.Contains(err.Error(), "stay applied")) {
+			t.Errorf("Batch with failed rollback = %v, metadata %v", err, metadata)
+		} else if !rollback_fails && metadata["rolled_back"] != "" {
+			t.Errorf("Batch = %v, metadata %v", err, metadata)
+		}
+		// batch doesn't finish client transaction
+		if _, ok := s.Transactions.transactions[transaction_id]; !ok {
+			t.Errorf("Batch finished client transaction")
+		}
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBatchRejectsRowReturningOperations(t *testing.T) {
+	request := &pb.BatchRequest{Operations: []*pb.Operation{
+		{Type: pb.OperationType_SHOW_DATABASES},
+		deleteOperation("users"),
+	}}
+	if err := validateExecutedRequest(request); err == nil || !strings.Contains(err.Error(), "operations[0].type: operation type SHOW_DATABASES returns rows") {
+		t.Errorf("validateExecutedRequest = %v", err)
+	}
+}
@@ -15,17 +15,29 @@ type ServerConfig struct {
 	DatabaseConnectionProtocol string `json:"database_connection_protocol"`
 	DatabaseHost               string `json:"database_host"`
 	DatabasePort               uint   `json:"database_port"`
+	DatabaseName               string `json:"database_name"` // optional default db, requests override it with DatabaseName
 
 	ServerConnectionProtocol string `json:"server_connection_protocol"`
 	ServerHost               string `json:"server_host"`
 	ServerPort               uint   `json:"server_port"`
 
-	LogQueries bool `json:"log_queries"`
+	LogQueries      bool `json:"log_queries"`
+	CollectWarnings bool `json:"collect_warnings"` // SHOW WARNINGS after each statement (extra roundtrip)
+
+	StreamChunkSize uint32 `json:"stream_chunk_size"`
+
+	TransactionIdleTimeout uint `json:"transaction_idle_timeout"` // seconds
+	MaxTransactions        uint `json:"max_transactions"`         // each pins a conn, must be below DatabaseMaxOpenConns
 }
 
+// DatabaseMaxOpenConns is the size of db conn pool.
+const DatabaseMaxOpenConns = 10
+
 var SrvConf = &ServerConfig{}
 
-func init() {
+// initServerConfig loads config from -config flag, it's called by main (not init), so that
+// flags of tests don't reach it.
+func initServerConfig() {
 	configPath := flag.String("config", "", "config path")
 
 	flag.Parse()
@@ -92,16 +104,37 @@ func (sc *ServerConfig) verify() {
 		log.Printf("ServerPort == 0, setting to default: 5555.")
 		sc.ServerPort = 5555
 	}
+
+	// streaming
+	if sc.StreamChunkSize == 0 {
+		log.Printf("StreamChunkSize == 0, setting to default: 1000.")
+		sc.StreamChunkSize = 1000
+	}
+
+	// transactions
+	if sc.TransactionIdleTimeout == 0 {
+		log.Printf("TransactionIdleTimeout == 0, setting to default: 300.")
+		sc.TransactionIdleTimeout = 300
+	}
+	if sc.MaxTransactions == 0 {
+		log.Printf("MaxTransactions == 0, setting to default: %d.", DatabaseMaxOpenConns/2)
+		sc.MaxTransactions = DatabaseMaxOpenConns / 2
+	}
+	if sc.MaxTransactions >= DatabaseMaxOpenConns {
+		log.Panicf("MaxTransactions must be below %d (conn pool size)!", DatabaseMaxOpenConns)
+	}
 }
 
-// username:password@protocol(host:port)/  <-- empty db name required!
+// username:password@protocol(host:port)/dbname  <-- dbname may be empty (requests pick it with DatabaseName),
+// conns are switched back to it after such requests, without it they can't be reused.
 func (sc *ServerConfig) DataSourceName() string {
 	return fmt.Sprintf(
-		"%s:%s@%s(%s:%d)/",
+		"%s:%s@%s(%s:%d)/%s",
 		SrvConf.DatabaseUsername,
 		SrvConf.DatabasePassword,
 		SrvConf.DatabaseConnectionProtocol,
 		SrvConf.DatabaseHost,
 		SrvConf.DatabasePort,
+		SrvConf.DatabaseName,
 	)
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorInfo domain and reasons, reasons are stable and meant to be matched by clients.
+const errorDomain = "dblabs-server"
+
+const (
+	reasonInvalidRequest      = "INVALID_REQUEST"
+	reasonSyntaxError         = "SYNTAX_ERROR"
+	reasonInvalidValue        = "INVALID_VALUE"
+	reasonDuplicateKey        = "DUPLICATE_KEY"
+	reasonAlreadyExists       = "ALREADY_EXISTS"
+	reasonNotFound            = "NOT_FOUND"
+	reasonForeignKeyViolation = "FOREIGN_KEY_VIOLATION"
+	reasonDeadlock            = "DEADLOCK"
+	reasonLockWaitTimeout     = "LOCK_WAIT_TIMEOUT"
+	reasonAccessDenied        = "ACCESS_DENIED"
+	reasonUnknownTransaction  = "UNKNOWN_TRANSACTION"
+	reasonTooManyTransactions = "TOO_MANY_TRANSACTIONS"
+	reasonTransactionAborted  = "TRANSACTION_ABORTED"
+	reasonUnavailable         = "UNAVAILABLE"
+	reasonCancelled           = "CANCELLED"
+	reasonDatabaseError       = "DATABASE_ERROR"
+	reasonInternal            = "INTERNAL"
+)
+
+type errorClass struct {
+	reason    string
+	code      codes.Code
+	retryable bool
+}
+
+// retryDelay is suggested to clients in RetryInfo of retryable errors.
+const retryDelay = 100 * time.Millisecond
+
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+var mysqlErrorClasses = map[uint16]errorClass{
+	1062: {reasonDuplicateKey, codes.AlreadyExists, false},             // ER_DUP_ENTRY
+	1586: {reasonDuplicateKey, codes.AlreadyExists, false},             // ER_DUP_ENTRY_WITH_KEY_NAME
+	1007: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_DB_CREATE_EXISTS
+	1050: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_TABLE_EXISTS_ERROR
+	1060: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_DUP_FIELDNAME
+	1061: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_DUP_KEYNAME
+	1304: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_SP_ALREADY_EXISTS
+	1359: {reasonAlreadyExists, codes.AlreadyExists, false},            // ER_TRG_ALREADY_EXISTS
+	1008: {reasonNotFound, codes.NotFound, false},                      // ER_DB_DROP_EXISTS
+	1049: {reasonNotFound, codes.NotFound, false},                      // ER_BAD_DB_ERROR
+	1051: {reasonNotFound, codes.NotFound, false},                      // ER_BAD_TABLE_ERROR
+	1054: {reasonNotFound, codes.NotFound, false},                      // ER_BAD_FIELD_ERROR
+	1091: {reasonNotFound, codes.NotFound, false},                      // ER_CANT_DROP_FIELD_OR_KEY
+	1146: {reasonNotFound, codes.NotFound, false},                      // ER_NO_SUCH_TABLE
+	1305: {reasonNotFound, codes.NotFound, false},                      // ER_SP_DOES_NOT_EXIST
+	1360: {reasonNotFound, codes.NotFound, false},                      // ER_TRG_DOES_NOT_EXIST
+	1216: {reasonForeignKeyViolation, codes.FailedPrecondition, false}, // ER_NO_REFERENCED_ROW
+	1217: {reasonForeignKeyViolation, codes.FailedPrecondition, false}, // ER_ROW_IS_REFERENCED
+	1451: {reasonForeignKeyViolation, codes.FailedPrecondition, false}, // ER_ROW_IS_REFERENCED_2
+	1452: {reasonForeignKeyViolation, codes.FailedPrecondition, false}, // ER_NO_REFERENCED_ROW_2
+	1213: {reasonDeadlock, codes.Aborted, true},                        // ER_LOCK_DEADLOCK
+	1205: {reasonLockWaitTimeout, codes.Aborted, true},                 // ER_LOCK_WAIT_TIMEOUT
+	1064: {reasonSyntaxError, codes.InvalidArgument, false},            // ER_PARSE_ERROR
+	1048: {reasonInvalidValue, codes.InvalidArgument, false},           // ER_BAD_NULL_ERROR
+	1264: {reasonInvalidValue, codes.InvalidArgument, false},           // ER_WARN_DATA_OUT_OF_RANGE
+	1265: {reasonInvalidValue, codes.InvalidArgument, false},           // WARN_DATA_TRUNCATED
+	1366: {reasonInvalidValue, codes.InvalidArgument, false},           // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+	1406: {reasonInvalidValue, codes.InvalidArgument, false},           // ER_DATA_TOO_LONG
+	3819: {reasonInvalidValue, codes.InvalidArgument, false},           // ER_CHECK_CONSTRAINT_VIOLATED
+	1044: {reasonAccessDenied, codes.PermissionDenied, false},          // ER_DBACCESS_DENIED_ERROR
+	1045: {reasonAccessDenied, codes.PermissionDenied, false},          // ER_ACCESS_DENIED_ERROR
+	1142: {reasonAccessDenied, codes.PermissionDenied, false},          // ER_TABLEACCESS_DENIED_ERROR
+	1143: {reasonAccessDenied, codes.PermissionDenied, false},          // ER_COLUMNACCESS_DENIED_ERROR
+	1792: {reasonInvalidRequest, codes.FailedPrecondition, false},      // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+}
+
+func errorStatus(class errorClass, message string, metadata map[string]string, details ...*errdetails.BadRequest_FieldViolation) error {
+	st := status.New(class.code, message)
+	info := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: class.reason, Domain: errorDomain, Metadata: metadata}}
+	if len(details) > 0 {
+		info = append(info, &errdetails.BadRequest{FieldViolations: details})
+	}
+	if class.retryable {
+		info = append(info, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+	}
+	if st_with_details, err := st.WithDetails(info...); err != nil {
+		return st.Err()
+	} else {
+		return st_with_details.Err()
+	}
+}
+
+// withStatusDetails attaches details to status error, err is returned as is if they can't be attached.
+func withStatusDetails(err error, details ...protoadapt.MessageV1) error {
+	if st_with_details, details_err := status.Convert(err).WithDetails(details...); details_err != nil {
+		return err
+	} else {
+		return st_with_details.Err()
+	}
+}
+
+// buildErrorStatus converts query builder (request validation) error into InvalidArgument status,
+// each violation of validationError becomes BadRequest field violation.
+func buildErrorStatus(err error) error {
+	var validation_err *validationError
+	violations := []*errdetails.BadRequest_FieldViolation{}
+	if errors.As(err, &validation_err) {
+		for _, violation := range validation_err.violations {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: violation.field, Description: violation.description})
+		}
+	} else {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Description: err.Error()})
+	}
+	return errorStatus(
+		errorClass{reasonInvalidRequest, codes.InvalidArgument, false},
+		err.Error(),
+		nil,
+		violations...,
+	)
+}
+
+// classifyExecError maps query execution error to error class, mysql errno and SQLSTATE go to metadata.
+func classifyExecError(err error) (class errorClass, metadata map[string]string) {
+	var mysql_err *mysql.MySQLError
+	metadata = map[string]string{}
+	if errors.Is(err, context.Canceled) {
+		return errorClass{reasonCancelled, codes.Canceled, false}, metadata
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return errorClass{reasonCancelled, codes.DeadlineExceeded, false}, metadata
+	} else if errors.Is(err, errUnknownTransaction) {
+		return errorClass{reasonUnknownTransaction, codes.NotFound, false}, metadata
+	} else if errors.Is(err, errTransactionAborted) {
+		return errorClass{reasonTransactionAborted, codes.Aborted, false}, metadata
+	} else if errors.Is(err, errTooManyTransactions) {
+		return errorClass{reasonTooManyTransactions, codes.ResourceExhausted, false}, metadata
+	} else if errors.Is(err, errTransactionDatabaseMismatch) {
+		return errorClass{reasonInvalidRequest, codes.FailedPrecondition, false}, metadata
+	} else if errors.As(err, &mysql_err) {
+		metadata["mysql_errno"] = strconv.FormatUint(uint64(mysql_err.Number), 10)
+		metadata["sqlstate"] = string(mysql_err.SQLState[:])
+		if class, ok := mysqlErrorClasses[mysql_err.Number]; ok {
+			return class, metadata
+		} else {
+			return errorClass{reasonDatabaseError, codes.Unknown, false}, metadata
+		}
+	} else if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return errorClass{reasonUnavailable, codes.Unavailable, true}, metadata
+	} else {
+		return errorClass{reasonInternal, codes.Internal, false}, metadata
+	}
+}
+
+func execErrorStatus(err error) error {
+	class, metadata := classifyExecError(err)
+	return errorStatus(class, err.Error(), metadata)
+}
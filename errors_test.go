@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyExecError(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		reason   string
+		code     codes.Code
+		errno    string
+		sqlstate string
+	}{
+		{&mysql.MySQLError{Number: 1062, SQLState: [5]byte{'2', '3', '0', '0', '0'}}, reasonDuplicateKey, codes.AlreadyExists, "1062", "23000"},
+		{&mysql.MySQLError{Number: 1146, SQLState: [5]byte{'4', '2', 'S', '0', '2'}}, reasonNotFound, codes.NotFound, "1146", "42S02"},
+		{&mysql.MySQLError{Number: 1452}, reasonForeignKeyViolation, codes.FailedPrecondition, "1452", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1213}, reasonDeadlock, codes.Aborted, "1213", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1205}, reasonLockWaitTimeout, codes.Aborted, "1205", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1064}, reasonSyntaxError, codes.InvalidArgument, "1064", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 3819}, reasonInvalidValue, codes.InvalidArgument, "3819", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1142}, reasonAccessDenied, codes.PermissionDenied, "1142", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1792}, reasonInvalidRequest, codes.FailedPrecondition, "1792", "\x00\x00\x00\x00\x00"},
+		{&mysql.MySQLError{Number: 1234}, reasonDatabaseError, codes.Unknown, "1234", "\x00\x00\x00\x00\x00"},
+		// wrapped like execTx does
+		{fmt.Errorf("failed exec, err: %w", &mysql.MySQLError{Number: 1062}), reasonDuplicateKey, codes.AlreadyExists, "1062", "\x00\x00\x00\x00\x00"},
+		{context.Canceled, reasonCancelled, codes.Canceled, "", ""},
+		{context.DeadlineExceeded, reasonCancelled, codes.DeadlineExceeded, "", ""},
+		{fmt.Errorf("%w abc", errUnknownTransaction), reasonUnknownTransaction, codes.NotFound, "", ""},
+		{fmt.Errorf("%w abc: %w", errTransactionAborted, driver.ErrBadConn), reasonTransactionAborted, codes.Aborted, "", ""},
+		{errTooManyTransactions, reasonTooManyTransactions, codes.ResourceExhausted, "", ""},
+		{errTransactionDatabaseMismatch, reasonInvalidRequest, codes.FailedPrecondition, "", ""},
+		{driver.ErrBadConn, reasonUnavailable, codes.Unavailable, "", ""},
+		{mysql.ErrInvalidConn, reasonUnavailable, codes.Unavailable, "", ""},
+		{errors.New("something else"), reasonInternal, codes.Internal, "", ""},
+	} {
+		class, metadata := classifyExecError(tc.err)
+		if class.reason != tc.reason || class.code != tc.code {
+			t.Errorf("classifyExecError(%v) = %s %s, want %s %s", tc.err, class.reason, class.code, tc.reason, tc.code)
+		}
+		if metadata["mysql_errno"] != tc.errno || metadata["sqlstate"] != tc.sqlstate {
+			t.Errorf("classifyExecError(%v) metadata = %v, want errno %q sqlstate %q", tc.err, metadata, tc.errno, tc.sqlstate)
+		}
+	}
+}
+
+func TestExecErrorStatusDetails(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{driver.ErrBadConn, true},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+	} {
+		st := status.Convert(execErrorStatus(tc.err))
+		var info *errdetails.ErrorInfo
+		var retry_info *errdetails.RetryInfo
+		for _, detail := range st.Details() {
+			switch detail := detail.(type) {
+			case *errdetails.ErrorInfo:
+				info = detail
+			case *errdetails.RetryInfo:
+				retry_info = detail
+			}
+		}
+		if info == nil || info.GetDomain() != errorDomain {
+			t.Errorf("execErrorStatus(%v) ErrorInfo = %v", tc.err, info)
+		}
+		if tc.retryable && (retry_info == nil || retry_info.GetRetryDelay().AsDuration() != retryDelay) {
+			t.Errorf("execErrorStatus(%v) RetryInfo = %v, want %s delay", tc.err, retry_info, retryDelay)
+		} else if !tc.retryable && retry_info != nil {
+			t.Errorf("execErrorStatus(%v) RetryInfo = %v, want none", tc.err, retry_info)
+		}
+	}
+}
+
+func TestBuildErrorStatusDetails(t *testing.T) {
+	v := &validator{}
+	v.fail("select_data.table_name", "required")
+	v.fail("select_data.limit", "must be positive")
+	for _, tc := range []struct {
+		err        error
+		violations []*errdetails.BadRequest_FieldViolation
+	}{
+		{v.err(), []*errdetails.BadRequest_FieldViolation{
+			{Field: "select_data.table_name", Description: "required"},
+			{Field: "select_data.limit", Description: "must be positive"},
+		}},
+		{buildQueryError("unknown operation type"), []*errdetails.BadRequest_FieldViolation{
+			{Description: "error while building query: unknown operation type"},
+		}},
+	} {
+		st := status.Convert(buildErrorStatus(tc.err))
+		if st.Code() != codes.InvalidArgument {
+			t.Errorf("buildErrorStatus(%v) code = %s", tc.err, st.Code())
+		}
+		var bad_request *errdetails.BadRequest
+		for _, detail := range st.Details() {
+			if detail, ok := detail.(*errdetails.BadRequest); ok {
+				bad_request = detail
+			}
+		}
+		if bad_request == nil || len(bad_request.GetFieldViolations()) != len(tc.violations) {
+			t.Fatalf("buildErrorStatus(%v) BadRequest = %v, want %v", tc.err, bad_request, tc.violations)
+		}
+		for i, violation := range bad_request.GetFieldViolations() {
+			if violation.GetField() != tc.violations[i].Field || violation.GetDescription() != tc.violations[i].Description {
+				t.Errorf("buildErrorStatus(%v) violation %d = %v, want %v", tc.err, i, violation, tc.violations[i])
+			}
+		}
+	}
+}
+
+func TestExecErrorStatusOmitsQuery(t *testing.T) {
+	s, mock := newMockServer(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `users` WHERE `name` = ?").WithArgs("secret").WillReturnError(&mysql.MySQLError{Number: 1142, Message: "DELETE command denied"})
+	mock.ExpectRollback()
+	_, err := s.execQuery(context.Background(), "", "", "DELETE FROM `users` WHERE `name` = ?", "secret")
+	if err = execErrorStatus(err); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("execErrorStatus = %v, want PermissionDenied", err)
+	} else if strings.Contains(status.Convert(err).Message(), "DELETE FROM") {
+		t.Errorf("execErrorStatus message %q has the query", status.Convert(err).Message())
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+// Expression tree is the structured alternative to raw WHERE, HAVING and ON condition strings.
+// Every operator node is rendered in parentheses, so precedence never depends on the client,
+// literals become placeholders.
+
+var comparisonOperators = map[pb.ComparisonOperator]string{
+	pb.ComparisonOperator_EQ:           "=",
+	pb.ComparisonOperator_NE:           "<>",
+	pb.ComparisonOperator_LT:           "<",
+	pb.ComparisonOperator_LE:           "<=",
+	pb.ComparisonOperator_GT:           ">",
+	pb.ComparisonOperator_GE:           ">=",
+	pb.ComparisonOperator_NULL_SAFE_EQ: "<=>",
+}
+
+// isFunctionName reports whether name is a plain function name, which can't be quoted:
+// mysql treats quoted names as stored functions, not builtins.
+func isFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// expressionOperandCount returns min and max operand count of expression type, max -1 is unlimited.
+func expressionOperandCount(expr *pb.Expression) (min_operands int, max_operands int) {
+	switch expr.GetType() {
+	case pb.ExpressionType_COMPARISON, pb.ExpressionType_LIKE:
+		return 2, 2
+	case pb.ExpressionType_AND, pb.ExpressionType_OR:
+		return 2, -1
+	case pb.ExpressionType_NOT, pb.ExpressionType_IS_NULL:
+		return 1, 1
+	case pb.ExpressionType_IN:
+		if expr.GetSubquery() != nil {
+			return 1, 1
+		}
+		return 2, -1
+	case pb.ExpressionType_BETWEEN:
+		return 3, 3
+	case pb.ExpressionType_FUNCTION:
+		return 0, -1
+	default:
+		return 0, 0
+	}
+}
+
+func negationQueryPartBuilder(expr *pb.Expression) string {
+	if expr.GetNegated() {
+		return "NOT "
+	}
+	return ""
+}
+
+func expressionListQueryPartBuilder(exprs []*pb.Expression) (query_parts []string, args []any, err error) {
+	for _, expr := range exprs {
+		var query_part string
+		var expr_args []any
+		if query_part, expr_args, err = expressionQueryPartBuilder(expr); err != nil {
+			return nil, nil, err
+		} else {
+			query_parts = append(query_parts, query_part)
+			args = append(args, expr_args...)
+		}
+	}
+	return
+}
+
+func expressionQueryPartBuilder(expr *pb.Expression) (query_part string, args []any, err error) {
+	if expr == nil {
+		return "", nil, buildQueryPartError("no expression data")
+	} else if _, ok := pb.ExpressionType_name[int32(expr.GetType())]; !ok {
+		return "", nil, buildQueryPartError("unknown expression type")
+	} else if min_operands, max_operands := expressionOperandCount(expr); len(expr.GetOperands()) < min_operands || (max_operands != -1 && len(expr.GetOperands()) > max_operands) {
+		return "", nil, buildQueryPartError("wrong operand count %d for %s expression", len(expr.GetOperands()), expr.GetType().String())
+	}
+
+	var operands []string
+	if operands, args, err = expressionListQueryPartBuilder(expr.GetOperands()); err != nil {
+		return "", nil, err
+	}
+	switch expr.GetType() {
+	case pb.ExpressionType_COLUMN:
+		if expr.GetColumnName() == "" {
+			return "", nil, buildQueryPartError("no expression col name")
+		} else if query_part, err = quoteOperandColumnName(expr.GetColumnName()); err != nil {
+			return "", nil, err
+		}
+	case pb.ExpressionType_LITERAL:
+		if expr.GetValue().GetType() == pb.ValueType_VALUE_DEFAULT {
+			return "", nil, buildQueryPartError("DEFAULT isn't allowed in expression")
+		}
+		return valueQueryPartBuilder(expr.GetValue())
+	case pb.ExpressionType_COMPARISON:
+		if operator, ok := comparisonOperators[expr.GetOperator()]; !ok {
+			return "", nil, buildQueryPartError("unknown comparison operator")
+		} else {
+			query_part = fmt.Sprintf("(%s %s %s)", operands[0], operator, operands[1])
+		}
+	case pb.ExpressionType_AND:
+		query_part = "(" + strings.Join(operands, " AND ") + ")"
+	case pb.ExpressionType_OR:
+		query_part = "(" + strings.Join(operands, " OR ") + ")"
+	case pb.ExpressionType_NOT:
+		query_part = fmt.Sprintf("(NOT %s)", operands[0])
+	case pb.ExpressionType_IN:
+		if expr.GetSubquery() != nil {
+			var subquery string
+			var subquery_args []any
+			if subquery, subquery_args, err = selectDataQueryPartBuilder(expr.GetSubquery()); err != nil {
+				return "", nil, err
+			} else {
+				query_part = fmt.Sprintf("(%s %sIN (%s))", operands[0], negationQueryPartBuilder(expr), subquery)
+				args = append(args, subquery_args...)
+			}
+		} else {
+			query_part = fmt.Sprintf("(%s %sIN (%s))", operands[0], negationQueryPartBuilder(expr), strings.Join(operands[1:], ", "))
+		}
+	case pb.ExpressionType_BETWEEN:
+		query_part = fmt.Sprintf("(%s %sBETWEEN %s AND %s)", operands[0], negationQueryPartBuilder(expr), operands[1], operands[2])
+	case pb.ExpressionType_LIKE:
+		query_part = fmt.Sprintf("(%s %sLIKE %s)", operands[0], negationQueryPartBuilder(expr), operands[1])
+	case pb.ExpressionType_IS_NULL:
+		query_part = fmt.Sprintf("(%s IS %sNULL)", operands[0], negationQueryPartBuilder(expr))
+	case pb.ExpressionType_FUNCTION:
+		if !isFunctionName(expr.GetFunctionName()) {
+			return "", nil, buildQueryPartError("invalid function name %q", expr.GetFunctionName())
+		} else {
+			query_part = fmt.Sprintf("%s(%s)", expr.GetFunctionName(), strings.Join(operands, ", "))
+		}
+	case pb.ExpressionType_SUBQUERY, pb.ExpressionType_EXISTS:
+		var subquery string
+		var subquery_args []any
+		if subquery, subquery_args, err = selectDataQueryPartBuilder(expr.GetSubquery()); err != nil {
+			return "", nil, err
+		} else if expr.GetType() == pb.ExpressionType_EXISTS {
+			query_part = fmt.Sprintf("(%sEXISTS (%s))", negationQueryPartBuilder(expr), subquery)
+		} else {
+			query_part = fmt.Sprintf("(%s)", subquery)
+		}
+		args = append(args, subquery_args...)
+	}
+	return
+}
+
+// conditionQueryPartBuilder renders either raw condition with params or expression, whichever is set.
+func conditionQueryPartBuilder(condition string, params []*pb.Value, expr *pb.Expression) (query_part string, args []any, err error) {
+	if expr == nil {
+		return paramsQueryPartBuilder(condition, params)
+	} else if condition != "" || len(params) > 0 {
+		return "", nil, buildQueryPartError("condition and expression are mutually exclusive")
+	} else {
+		return expressionQueryPartBuilder(expr)
+	}
+}
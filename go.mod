@@ -2,4 +2,7 @@ module greateapot.re/dblabs-server
 
 go 1.21.3
 
-require github.com/go-sql-driver/mysql v1.7.1
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/go-sql-driver/mysql v1.7.1
+)
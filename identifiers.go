@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// https://dev.mysql.com/doc/refman/8.0/en/identifiers.html
+const maxIdentifierLength = 64
+
+func identifierError(name string, format string, a ...any) error {
+	return fmt.Errorf("invalid identifier %q: %s", name, fmt.Sprintf(format, a...))
+}
+
+func failIdentifier(name string, format string, a ...any) (quoted string, err error) {
+	return "", identifierError(name, format, a...)
+}
+
+// validateIdentifier checks single (not qualified) identifier against mysql rules
+// for quoted identifiers: no NUL, no supplementary chars, no trailing spaces, 64 chars max.
+func validateIdentifier(name string) error {
+	if name == "" {
+		return identifierError(name, "empty")
+	} else if !utf8.ValidString(name) {
+		return identifierError(name, "not a valid utf-8 string")
+	} else if utf8.RuneCountInString(name) > maxIdentifierLength {
+		return identifierError(name, "longer than %d chars", maxIdentifierLength)
+	} else if strings.HasSuffix(name, " ") {
+		return identifierError(name, "ends with space")
+	}
+	for _, r := range name {
+		if r == 0 || r > 0xFFFF {
+			return identifierError(name, "char %U is not permitted", r)
+		}
+	}
+	return nil
+}
+
+// splitQualifiedIdentifier splits names like db.table or `db`.`ta.ble` into unquoted parts.
+// Backticks are only allowed around whole parts, doubled backtick inside them is an escape.
+func splitQualifiedIdentifier(name string) (parts []string, err error) {
+	if name == "" {
+		return nil, identifierError(name, "empty")
+	}
+	for i := 0; i <= len(name); {
+		var part string
+		if i < len(name) && name[i] == '`' {
+			closed := false
+			quoted_part := strings.Builder{}
+			for i++; i < len(name); i++ {
+				if name[i] != '`' {
+					quoted_part.WriteByte(name[i])
+				} else if i+1 < len(name) && name[i+1] == '`' {
+					quoted_part.WriteByte('`')
+					i++
+				} else {
+					closed = true
+					i++
+					break
+				}
+			}
+			if !closed {
+				return nil, identifierError(name, "unterminated quoted part")
+			} else if i < len(name) && name[i] != '.' {
+				return nil, identifierError(name, "unexpected char after quoted part")
+			}
+			part = quoted_part.String()
+		} else {
+			end := strings.IndexByte(name[i:], '.')
+			if end == -1 {
+				end = len(name)
+			} else {
+				end += i
+			}
+			part = name[i:end]
+			if strings.ContainsRune(part, '`') {
+				return nil, identifierError(name, "unbalanced backtick")
+			}
+			i = end
+		}
+		if part == "" {
+			return nil, identifierError(name, "empty part")
+		} else if err = validateIdentifier(part); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		i++ // skip dot (or step past the end)
+	}
+	return parts, nil
+}
+
+func quoteIdentifierPart(part string) string {
+	return "`" + strings.ReplaceAll(part, "`", "``") + "`"
+}
+
+func quoteQualifiedIdentifier(name string, max_parts int) (quoted string, err error) {
+	if parts, err := splitQualifiedIdentifier(name); err != nil {
+		return "", err
+	} else if len(parts) > max_parts {
+		return failIdentifier(name, "too many qualifiers (%d parts, max %d)", len(parts), max_parts)
+	} else {
+		for i := range parts {
+			parts[i] = quoteIdentifierPart(parts[i])
+		}
+		return strings.Join(parts, "."), nil
+	}
+}
+
+// quoteIdentifier: db names, aliases, unqualified col names, constraint/key symbols.
+func quoteIdentifier(name string) (quoted string, err error) {
+	return quoteQualifiedIdentifier(name, 1)
+}
+
+// quoteSchemaObjectName: [db.]name for tables, views, triggers and procedures.
+func quoteSchemaObjectName(name string) (quoted string, err error) {
+	return quoteQualifiedIdentifier(name, 2)
+}
+
+// quoteColumnName: [[db.]table.]column.
+func quoteColumnName(name string) (quoted string, err error) {
+	return quoteQualifiedIdentifier(name, 3)
+}
+
+// isUnquotedIdentifierChar reports whether r may appear in unquoted identifier.
+func isUnquotedIdentifierChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '$' || r >= 0x80
+}
+
+// isExpressionLike reports whether name has chars outside of backticks which unquoted identifiers
+// can't contain, e.g. COUNT(*) or `u.name AS n`.
+func isExpressionLike(name string) bool {
+	quoted := false
+	for _, r := range name {
+		if r == '`' {
+			quoted = !quoted // doubled backtick toggles twice
+		} else if !quoted && r != '.' && !isUnquotedIdentifierChar(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteSelectColumnName is quoteColumnName which also accepts * and [[db.]table.]* wildcards.
+// Expressions (and aliases) aren't col names, they are rejected instead of being quoted as ones.
+func quoteSelectColumnName(name string) (quoted string, err error) {
+	if name == "*" {
+		return name, nil
+	} else if qualifier, found := strings.CutSuffix(name, ".*"); found {
+		if quoted, err = quoteSchemaObjectName(qualifier); err != nil {
+			return "", err
+		} else {
+			return quoted + ".*", nil
+		}
+	} else if isExpressionLike(name) {
+		return failIdentifier(name, "expressions and aliases aren't col names, use select_items (EXPR type) or backticks")
+	} else {
+		return quoteColumnName(name)
+	}
+}
+
+// quoteOperandColumnName is quoteSelectColumnName of expression operand, wildcards aren't values there.
+func quoteOperandColumnName(name string) (quoted string, err error) {
+	if name == "*" || strings.HasSuffix(name, ".*") {
+		return failIdentifier(name, "wildcard isn't an expression operand")
+	} else {
+		return quoteSelectColumnName(name)
+	}
+}
+
+// quoteIdentifierList quotes each name with quote and joins them with ", ".
+func quoteIdentifierList(names []string, quote func(string) (string, error)) (quoted string, err error) {
+	quoted_names := make([]string, 0, len(names))
+	for _, name := range names {
+		var quoted_name string
+		if quoted_name, err = quote(name); err != nil {
+			return "", err
+		} else {
+			quoted_names = append(quoted_names, quoted_name)
+		}
+	}
+	return strings.Join(quoted_names, ", "), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitQualifiedIdentifier(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		ok    bool
+	}{
+		{"users", []string{"users"}, true},
+		{"db.users", []string{"db", "users"}, true},
+		{"db.users.id", []string{"db", "users", "id"}, true},
+		{"`order`", []string{"order"}, true},
+		{"`db`.`ta.ble`", []string{"db", "ta.ble"}, true},
+		{"`a``b`", []string{"a`b"}, true},
+		{"my-table", []string{"my-table"}, true},
+		{"`db`.users", []string{"db", "users"}, true},
+		{"", nil, false},
+		{".users", nil, false},
+		{"db.", nil, false},
+		{"db..users", nil, false},
+		{"`users", nil, false},
+		{"`a`b", nil, false},
+		{"a`b", nil, false},
+		{"users`; DROP TABLE x; --", nil, false},
+		{"trailing ", nil, false},
+		{"nul\x00", nil, false},
+		{"emoji\U0001F600", nil, false},
+		{"bad\xffutf8", nil, false},
+		{strings.Repeat("a", maxIdentifierLength), []string{strings.Repeat("a", maxIdentifierLength)}, true},
+		{strings.Repeat("a", maxIdentifierLength+1), nil, false},
+	}
+	for _, test := range tests {
+		parts, err := splitQualifiedIdentifier(test.name)
+		if test.ok && err != nil {
+			t.Errorf("splitQualifiedIdentifier(%q): unexpected err: %s", test.name, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("splitQualifiedIdentifier(%q) = %q, want err", test.name, parts)
+		} else if !reflect.DeepEqual(parts, test.parts) {
+			t.Errorf("splitQualifiedIdentifier(%q) = %q, want %q", test.name, parts, test.parts)
+		}
+	}
+}
+
+func TestQuoteIdentifiers(t *testing.T) {
+	tests := []struct {
+		quote  func(string) (string, error)
+		name   string
+		quoted string
+	}{
+		{quoteIdentifier, "order", "`order`"},
+		{quoteIdentifier, "a`b", ""},
+		{quoteIdentifier, "`a``b`", "`a``b`"},
+		{quoteIdentifier, "db.users", ""},
+		{quoteSchemaObjectName, "db.users", "`db`.`users`"},
+		{quoteSchemaObjectName, "db.users.id", ""},
+		{quoteColumnName, "db.users.id", "`db`.`users`.`id`"},
+		{quoteColumnName, "a.db.users.id", ""},
+		{quoteSelectColumnName, "*", "*"},
+		{quoteSelectColumnName, "users.*", "`users`.*"},
+		{quoteSelectColumnName, "db.users.*", "`db`.`users`.*"},
+		{quoteSelectColumnName, "a.db.users.*", ""},
+		{quoteSelectColumnName, "COUNT(*)", ""},
+		{quoteSelectColumnName, "u.name AS n", ""},
+		{quoteSelectColumnName, "u.$name_2", "`u`.`$name_2`"},
+		{quoteSelectColumnName, "`my col(1)`", "`my col(1)`"},
+		{quoteSelectColumnName, "`a``b`.c", "`a``b`.`c`"},
+	}
+	for _, test := range tests {
+		quoted, err := test.quote(test.name)
+		if test.quoted == "" && err == nil {
+			t.Errorf("quote(%q) = %q, want err", test.name, quoted)
+		} else if test.quoted != "" && (err != nil || quoted != test.quoted) {
+			t.Errorf("quote(%q) = %q, %v, want %q", test.name, quoted, err, test.quoted)
+		}
+	}
+}
+
+func TestQuoteIdentifierList(t *testing.T) {
+	if quoted, err := quoteIdentifierList([]string{"id", "group", "t.name"}, quoteColumnName); err != nil || quoted != "`id`, `group`, `t`.`name`" {
+		t.Errorf("quoteIdentifierList = %q, %v", quoted, err)
+	}
+	if _, err := quoteIdentifierList([]string{"id", "x`"}, quoteColumnName); err == nil {
+		t.Errorf("quoteIdentifierList: want err for invalid name")
+	}
+}
@@ -15,6 +15,8 @@ import (
 )
 
 func main() {
+	initServerConfig()
+
 	db, err := sql.Open(
 		"mysql",
 		SrvConf.DataSourceName(),
@@ -26,8 +28,8 @@ func main() {
 	defer db.Close()
 
 	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	db.SetMaxOpenConns(DatabaseMaxOpenConns)
+	db.SetMaxIdleConns(DatabaseMaxOpenConns)
 
 	listener, err := net.Listen(
 		SrvConf.ServerConnectionProtocol,
@@ -37,7 +39,10 @@ func main() {
 		log.Panicf("failed to listen: %v", err)
 	}
 
+	transactions := newTransactionRegistry(db, SrvConf.MaxTransactions)
+	go transactions.runJanitor(time.Second * time.Duration(SrvConf.TransactionIdleTimeout))
+
 	grpcServer := grpc.NewServer()
-	pb.RegisterApiServer(grpcServer, &ApiServer{DB: db})
+	pb.RegisterApiServer(grpcServer, &ApiServer{DB: db, Transactions: transactions})
 	grpcServer.Serve(listener)
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+// pageToken is keyset (cursor) continuation: values of OrderBy.ColumnNames of the last
+// returned row. Table, keys and direction are kept to reject tokens of other queries.
+// Pagination is opt-in (SelectRequest.Paginate), keys must be selected and should be unique:
+// if rows tie on them across page boundary, Skip is the count of already returned rows with
+// Values, the next page starts at Values (inclusive) and skips them with OFFSET. Order of tied
+// rows isn't guaranteed by mysql, so such pages may repeat or miss some of them.
+type pageToken struct {
+	Table  string           `json:"t"`
+	Keys   []string         `json:"k"`
+	Desc   bool             `json:"d"`
+	Values []pageTokenValue `json:"v"`
+	Skip   uint64           `json:"s,omitempty"`
+}
+
+type pageTokenValue struct {
+	Type  pb.ValueType `json:"t"`
+	Value string       `json:"v"`
+}
+
+func (pt *pageToken) matches(select_data *pb.SelectData) bool {
+	order_by := select_data.GetOrderBy()
+	if pt.Table != select_data.GetTableName() ||
+		pt.Desc != order_by.GetOrderByDescending() ||
+		len(pt.Keys) != len(order_by.GetColumnNames()) ||
+		len(pt.Values) != len(pt.Keys) {
+		return false
+	}
+	for i, key := range order_by.GetColumnNames() {
+		if pt.Keys[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+func decodePageToken(select_data *pb.SelectData, token string) (pt *pageToken, err error) {
+	pt = &pageToken{}
+	if b, err := base64.RawURLEncoding.DecodeString(token); err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	} else if err := json.Unmarshal(b, pt); err != nil {
+		return nil, fmt.Errorf("malformed page token")
+	} else if !pt.matches(select_data) {
+		return nil, fmt.Errorf("page token doesn't match select data (table, order by columns or direction changed)")
+	} else {
+		return pt, nil
+	}
+}
+
+// keysetQueryPartBuilder renders condition which continues after token, expanded as
+// `(k1 > ?) OR (k1 = ? AND k2 > ?)` to handle NULL keys, which mysql sorts first in ascending
+// order and last in descending one. Token with Skip continues at its values, offset is Skip.
+func keysetQueryPartBuilder(select_data *pb.SelectData, token string) (query_part string, args []any, offset uint64, err error) {
+	var pt *pageToken
+	if len(select_data.GetOrderBy().GetColumnNames()) == 0 {
+		return "", nil, 0, buildQueryPartError("page token requires order by col names")
+	} else if pt, err = decodePageToken(select_data, token); err != nil {
+		return "", nil, 0, buildQueryPartError("%s", err.Error())
+	}
+	keys := make([]string, len(pt.Keys))
+	key_args := make([]any, len(pt.Values))
+	for i, value := range pt.Values {
+		if keys[i], err = quoteColumnName(pt.Keys[i]); err != nil {
+			return "", nil, 0, err
+		}
+		switch value.Type {
+		case pb.ValueType_VALUE_NULL:
+			key_args[i] = nil
+		case pb.ValueType_VALUE_INT:
+			key_args[i], err = strconv.ParseInt(value.Value, 10, 64)
+		case pb.ValueType_VALUE_UINT:
+			key_args[i], err = strconv.ParseUint(value.Value, 10, 64)
+		case pb.ValueType_VALUE_DOUBLE:
+			key_args[i], err = strconv.ParseFloat(value.Value, 64)
+		case pb.ValueType_VALUE_BYTES:
+			key_args[i], err = base64.StdEncoding.DecodeString(value.Value)
+		case pb.ValueType_VALUE_STRING:
+			key_args[i] = value.Value
+		default:
+			err = fmt.Errorf("bad value type")
+		}
+		if err != nil {
+			return "", nil, 0, buildQueryPartError("malformed page token")
+		}
+	}
+	disjuncts := []string{}
+	for i := 0; i < len(keys) || (i == len(keys) && pt.Skip > 0); i++ {
+		conjuncts := []string{}
+		var conjunct_args []any
+		for j := 0; j < i; j++ {
+			if key_args[j] == nil {
+				conjuncts = append(conjuncts, keys[j]+" IS NULL")
+			} else {
+				conjuncts = append(conjuncts, keys[j]+" = ?")
+				conjunct_args = append(conjunct_args, key_args[j])
+			}
+		}
+		if i == len(keys) {
+			// all keys equal: rows tied with token values
+		} else if key_args[i] == nil && pt.Desc {
+			continue // NULL is the last value
+		} else if key_args[i] == nil {
+			conjuncts = append(conjuncts, keys[i]+" IS NOT NULL")
+		} else if pt.Desc {
+			conjuncts = append(conjuncts, fmt.Sprintf("(%s < ? OR %s IS NULL)", keys[i], keys[i]))
+			conjunct_args = append(conjunct_args, key_args[i])
+		} else {
+			conjuncts = append(conjuncts, keys[i]+" > ?")
+			conjunct_args = append(conjunct_args, key_args[i])
+		}
+		disjuncts = append(disjuncts, strings.Join(conjuncts, " AND "))
+		args = append(args, conjunct_args...)
+	}
+	if len(disjuncts) == 0 {
+		return "FALSE", nil, 0, nil
+	} else if len(disjuncts) == 1 {
+		return disjuncts[0], args, pt.Skip, nil
+	}
+	return "(" + strings.Join(disjuncts, ") OR (") + ")", args, pt.Skip, nil
+}
+
+// selectPaginated reports whether Select responds with NextPageToken: pagination is requested
+// explicitly, or continued with a page token.
+func selectPaginated(request *pb.SelectRequest) bool {
+	return request.GetPaginate() || request.GetPageToken() != ""
+}
+
+func lastIdentifierPart(name string) string {
+	if parts, err := splitQualifiedIdentifier(name); err != nil {
+		return ""
+	} else {
+		return parts[len(parts)-1]
+	}
+}
+
+// pageKeySelected reports whether order by key is one of result cols, token takes key values from them.
+func pageKeySelected(select_data *pb.SelectData, key string) bool {
+	column_name := lastIdentifierPart(key)
+	for _, name := range select_data.GetColumnNames() {
+		if name == "*" || strings.HasSuffix(name, ".*") || lastIdentifierPart(name) == column_name {
+			return true
+		}
+	}
+	for _, select_item := range select_data.GetSelectItems() {
+		if select_item.GetType() != pb.SelectItemType_COLUMN {
+			continue
+		} else if name := select_item.GetColumnName(); name == "*" || strings.HasSuffix(name, ".*") {
+			return true
+		} else if lastIdentifierPart(name) == column_name && (select_item.GetAlias() == "" || select_item.GetAlias() == column_name) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageKeyValues reads values of keys from row, ok is false if some key isn't a result col.
+func pageKeyValues(keys []string, columns []*pb.ResultColumn, row *pb.ResultRow) (values []pageTokenValue, ok bool) {
+	for _, key := range keys {
+		column_name, index := lastIdentifierPart(key), -1
+		for i, column := range columns {
+			if column.GetName() == column_name {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return nil, false
+		}
+		value := row.GetValues()[index]
+		switch value.GetType() {
+		case pb.ValueType_VALUE_NULL:
+			values = append(values, pageTokenValue{value.GetType(), ""})
+		case pb.ValueType_VALUE_INT:
+			values = append(values, pageTokenValue{value.GetType(), strconv.FormatInt(value.GetIntValue(), 10)})
+		case pb.ValueType_VALUE_UINT:
+			values = append(values, pageTokenValue{value.GetType(), strconv.FormatUint(value.GetUintValue(), 10)})
+		case pb.ValueType_VALUE_DOUBLE:
+			values = append(values, pageTokenValue{value.GetType(), strconv.FormatFloat(value.GetDoubleValue(), 'g', -1, 64)})
+		case pb.ValueType_VALUE_BYTES:
+			values = append(values, pageTokenValue{value.GetType(), base64.StdEncoding.EncodeToString(value.GetBytesValue())})
+		default:
+			values = append(values, pageTokenValue{pb.ValueType_VALUE_STRING, value.GetStringValue()})
+		}
+	}
+	return values, true
+}
+
+// pageRows cuts rows of paginated select (continued from page_token, if any) to Limit and returns
+// token for the next page, or "" if rows is the last page. Paginated query reads one row past Limit:
+// it tells whether the next page exists, and whether it ties with the last row on all keys.
+func pageRows(select_data *pb.SelectData, page_token string, columns []*pb.ResultColumn, rows []*pb.ResultRow) (page_rows []*pb.ResultRow, token string, err error) {
+	keys := select_data.GetOrderBy().GetColumnNames()
+	limit := int(select_data.GetLimit())
+	if len(rows) <= limit {
+		return rows, "", nil
+	}
+	last_values, ok := pageKeyValues(keys, columns, rows[limit-1])
+	if !ok {
+		log.Printf("Order by cols %v aren't in result cols, no page token", keys)
+		return rows[:limit], "", nil
+	}
+	pt := &pageToken{
+		Table:  select_data.GetTableName(),
+		Keys:   keys,
+		Desc:   select_data.GetOrderBy().GetOrderByDescending(),
+		Values: last_values,
+	}
+	if next_values, _ := pageKeyValues(keys, columns, rows[limit]); slices.Equal(last_values, next_values) {
+		log.Printf("Order by cols %v aren't unique, rows tie across page boundary", keys)
+		for i := limit - 1; i >= 0; i-- {
+			if values, _ := pageKeyValues(keys, columns, rows[i]); !slices.Equal(values, last_values) {
+				break
+			}
+			pt.Skip++
+		}
+		// whole page is the tie continued from the previous one
+		if prev, err := decodePageToken(select_data, page_token); err == nil && pt.Skip == uint64(limit) && slices.Equal(prev.Values, last_values) {
+			pt.Skip += prev.Skip
+		}
+	}
+	if b, err := json.Marshal(pt); err != nil {
+		return nil, "", fmt.Errorf("failed to marshal page token, err: %w", err)
+	} else {
+		return rows[:limit], base64.RawURLEncoding.EncodeToString(b), nil
+	}
+}
+
+// selectPage is pageRows of paginated Select, rows of other ones are returned as is.
+func selectPage(request *pb.SelectRequest, columns []*pb.ResultColumn, rows []*pb.ResultRow) (page_rows []*pb.ResultRow, token string, err error) {
+	if !selectPaginated(request) {
+		return rows, "", nil
+	}
+	return pageRows(request.GetSelectData(), request.GetPageToken(), columns, rows)
+}
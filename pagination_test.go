@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func pageTestRows(values ...[]*pb.Value) []*pb.ResultRow {
+	rows := []*pb.ResultRow{}
+	for _, row_values := range values {
+		rows = append(rows, &pb.ResultRow{Values: row_values})
+	}
+	return rows
+}
+
+func intValue(v int64) *pb.Value {
+	return &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: v}
+}
+
+func stringValue(v string) *pb.Value {
+	return &pb.Value{Type: pb.ValueType_VALUE_STRING, StringValue: v}
+}
+
+func nullValue() *pb.Value {
+	return &pb.Value{Type: pb.ValueType_VALUE_NULL}
+}
+
+var pageTestColumns = []*pb.ResultColumn{{Name: "name"}, {Name: "id"}}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc      bool
+		last_row  []*pb.Value
+		condition string
+		args      []any
+	}{
+		{false, []*pb.Value{stringValue("b"), intValue(2)}, "(`name` > ?) OR (`name` = ? AND `users`.`id` > ?)", []any{"b", "b", int64(2)}},
+		{true, []*pb.Value{stringValue("b"), intValue(2)}, "((`name` < ? OR `name` IS NULL)) OR (`name` = ? AND (`users`.`id` < ? OR `users`.`id` IS NULL))", []any{"b", "b", int64(2)}},
+		{false, []*pb.Value{nullValue(), intValue(2)}, "(`name` IS NOT NULL) OR (`name` IS NULL AND `users`.`id` > ?)", []any{int64(2)}},
+		{true, []*pb.Value{nullValue(), intValue(2)}, "`name` IS NULL AND (`users`.`id` < ? OR `users`.`id` IS NULL)", []any{int64(2)}},
+		{true, []*pb.Value{nullValue(), nullValue()}, "FALSE", nil},
+	}
+	for _, test := range tests {
+		select_data := &pb.SelectData{
+			TableName:   "users",
+			ColumnNames: []string{"name", "id"},
+			OrderBy:     &pb.OrderBy{ColumnNames: []string{"name", "users.id"}, OrderByDescending: test.desc},
+			Limit:       2,
+		}
+		rows := pageTestRows([]*pb.Value{stringValue("a"), intValue(1)}, test.last_row, []*pb.Value{stringValue("c"), intValue(3)})
+		page_rows, token, err := pageRows(select_data, "", pageTestColumns, rows)
+		if err != nil {
+			t.Fatalf("pageRows: %s", err)
+		} else if len(page_rows) != 2 || token == "" {
+			t.Fatalf("pageRows = %d rows, token %q, want 2 rows and token", len(page_rows), token)
+		}
+		condition, args, _, err := keysetQueryPartBuilder(select_data, token)
+		if err != nil {
+			t.Errorf("keysetQueryPartBuilder: %s", err)
+		} else if condition != test.condition || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("keysetQueryPartBuilder = %q, %#v, want %q, %#v", condition, args, test.condition, test.args)
+		}
+	}
+}
+
+func TestPageRowsLastPage(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"name", "id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 2}
+	rows := pageTestRows([]*pb.Value{stringValue("a"), intValue(1)}, []*pb.Value{stringValue("b"), intValue(2)})
+	if page_rows, token, err := pageRows(select_data, "", pageTestColumns, rows); err != nil || len(page_rows) != 2 || token != "" {
+		t.Errorf("pageRows = %d rows, %q, %v, want full last page without token", len(page_rows), token, err)
+	}
+}
+
+func TestPageRowsTies(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"name", "id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"name"}}, Limit: 2}
+	rows := pageTestRows([]*pb.Value{stringValue("a"), intValue(1)}, []*pb.Value{stringValue("b"), intValue(2)}, []*pb.Value{stringValue("b"), intValue(3)})
+	_, token, err := pageRows(select_data, "", pageTestColumns, rows)
+	if err != nil || token == "" {
+		t.Fatalf("pageRows = %q, %v", token, err)
+	}
+	query, args, err := buildQuery(&pb.SelectRequest{SelectData: select_data, PageToken: token}, selectQueryBuilder)
+	if err != nil || query != "SELECT `name`, `id` FROM `users` WHERE (`name` > ?) OR (`name` = ?) ORDER BY `name` LIMIT 3 OFFSET 1" || !reflect.DeepEqual(args, []any{"b", "b"}) {
+		t.Errorf("selectQueryBuilder = %q, %#v, %v", query, args, err)
+	}
+	// whole page is the same tie, skip grows
+	rows = pageTestRows([]*pb.Value{stringValue("b"), intValue(3)}, []*pb.Value{stringValue("b"), intValue(4)}, []*pb.Value{stringValue("b"), intValue(5)})
+	if _, token, err = pageRows(select_data, token, pageTestColumns, rows); err != nil || token == "" {
+		t.Fatalf("pageRows = %q, %v", token, err)
+	}
+	if _, _, offset, err := keysetQueryPartBuilder(select_data, token); err != nil || offset != 3 {
+		t.Errorf("keysetQueryPartBuilder offset = %d, %v, want 3", offset, err)
+	}
+}
+
+func TestPageTokenMismatch(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}
+	rows := pageTestRows([]*pb.Value{intValue(1)}, []*pb.Value{intValue(2)})
+	_, token, err := pageRows(select_data, "", []*pb.ResultColumn{{Name: "id"}}, rows)
+	if err != nil || token == "" {
+		t.Fatalf("pageRows = %q, %v", token, err)
+	}
+	for _, other := range []*pb.SelectData{
+		{TableName: "orders", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1},
+		{TableName: "users", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}, OrderByDescending: true}, Limit: 1},
+		{TableName: "users", ColumnNames: []string{"id", "name"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"name", "id"}}, Limit: 1},
+	} {
+		if _, err := decodePageToken(other, token); err == nil {
+			t.Errorf("decodePageToken: want err for %v", other)
+		}
+	}
+	if _, err := decodePageToken(select_data, "not a token"); err == nil {
+		t.Errorf("decodePageToken: want err for malformed token")
+	}
+}
+
+func TestPaginatedSelectQuery(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, WhereCondition: "age > ?", WhereParams: []*pb.Value{intValue(18)}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 10}
+	query, args, err := buildQuery(&pb.SelectRequest{SelectData: select_data, Paginate: true}, selectQueryBuilder)
+	if err != nil || query != "SELECT `id` FROM `users` WHERE age > ? ORDER BY `id` LIMIT 11" {
+		t.Errorf("selectQueryBuilder = %q, %v", query, err)
+	}
+	_, token, _ := pageRows(select_data, "", []*pb.ResultColumn{{Name: "id"}}, pageTestRows(
+		[]*pb.Value{intValue(1)}, []*pb.Value{intValue(2)}, []*pb.Value{intValue(3)}, []*pb.Value{intValue(4)}, []*pb.Value{intValue(5)},
+		[]*pb.Value{intValue(6)}, []*pb.Value{intValue(7)}, []*pb.Value{intValue(8)}, []*pb.Value{intValue(9)}, []*pb.Value{intValue(10)},
+		[]*pb.Value{intValue(11)},
+	))
+	query, args, err = buildQuery(&pb.SelectRequest{SelectData: select_data, PageToken: token}, selectQueryBuilder)
+	if err != nil || query != "SELECT `id` FROM `users` WHERE (age > ?) AND (`id` > ?) ORDER BY `id` LIMIT 11" || !reflect.DeepEqual(args, []any{int64(18), int64(10)}) {
+		t.Errorf("selectQueryBuilder = %q, %#v, %v", query, args, err)
+	}
+	// plain order by + limit isn't paginated and doesn't read extra row
+	if query, _, err = buildQuery(&pb.SelectRequest{SelectData: select_data}, selectQueryBuilder); err != nil || !strings.HasSuffix(query, "LIMIT 10") {
+		t.Errorf("selectQueryBuilder = %q, %v", query, err)
+	}
+}
+
+func TestPaginationValidation(t *testing.T) {
+	tests := []struct {
+		select_data *pb.SelectData
+		ok          bool
+	}{
+		{&pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}, true},
+		{&pb.SelectData{TableName: "users", ColumnNames: []string{"*"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"users.id"}}, Limit: 1}, true},
+		{&pb.SelectData{TableName: "users", SelectItems: []*pb.SelectItem{{Type: pb.SelectItemType_COLUMN, ColumnName: "id"}}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}, true},
+		{&pb.SelectData{TableName: "users", SelectItems: []*pb.SelectItem{{Type: pb.SelectItemType_COLUMN, ColumnName: "id", Alias: "user_id"}}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}, false},
+		{&pb.SelectData{TableName: "users", ColumnNames: []string{"name"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}, false},
+		{&pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}}, false},
+		{&pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, OrderBy: &pb.OrderBy{Expr: "id"}, Limit: 1}, false},
+	}
+	for i, test := range tests {
+		if err := validateRequest(&pb.SelectRequest{SelectData: test.select_data, Paginate: true}); test.ok != (err == nil) {
+			t.Errorf("test %d: validateRequest = %v, want ok %t", i, err, test.ok)
+		}
+		// without pagination the same requests are plain selects
+		if err := validateRequest(&pb.SelectRequest{SelectData: test.select_data}); err != nil {
+			t.Errorf("test %d: validateRequest of plain select = %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+// scanCode calls fn with the offset of every byte of query which is sql code,
+// skipping string literals, quoted identifiers and comments.
+func scanCode(query string, fn func(offset int)) {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' && c != '`' {
+					i++ // escaped char
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++ // doubled quote
+					} else {
+						break
+					}
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			if end := strings.IndexByte(query[i:], '\n'); end == -1 {
+				i = len(query)
+			} else {
+				i += end
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end == -1 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+		default:
+			fn(i)
+		}
+	}
+}
+
+// scanPlaceholders calls fn with the offset of every `?` placeholder in query.
+func scanPlaceholders(query string, fn func(offset int)) {
+	scanCode(query, func(offset int) {
+		if query[offset] == '?' {
+			fn(offset)
+		}
+	})
+}
+
+func countPlaceholders(query string) (count int) {
+	scanPlaceholders(query, func(int) { count++ })
+	return
+}
+
+// valueParam converts typed literal value into driver arg.
+func valueParam(value *pb.Value) (arg any, err error) {
+	switch value.GetType() {
+	case pb.ValueType_VALUE_NULL:
+		return nil, nil
+	case pb.ValueType_VALUE_STRING:
+		return value.GetStringValue(), nil
+	case pb.ValueType_VALUE_INT:
+		return value.GetIntValue(), nil
+	case pb.ValueType_VALUE_UINT:
+		return value.GetUintValue(), nil
+	case pb.ValueType_VALUE_DOUBLE:
+		return value.GetDoubleValue(), nil
+	case pb.ValueType_VALUE_BOOL:
+		return value.GetBoolValue(), nil
+	case pb.ValueType_VALUE_BYTES:
+		return value.GetBytesValue(), nil
+	default:
+		return nil, fmt.Errorf("value type %s is not a literal", value.GetType().String())
+	}
+}
+
+// argValue converts driver arg back into typed value, the reverse of valueParam.
+func argValue(arg any) (value *pb.Value, err error) {
+	switch v := arg.(type) {
+	case nil:
+		return &pb.Value{Type: pb.ValueType_VALUE_NULL}, nil
+	case string:
+		return &pb.Value{Type: pb.ValueType_VALUE_STRING, StringValue: v}, nil
+	case int64:
+		return &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: v}, nil
+	case uint64:
+		return &pb.Value{Type: pb.ValueType_VALUE_UINT, UintValue: v}, nil
+	case float64:
+		return &pb.Value{Type: pb.ValueType_VALUE_DOUBLE, DoubleValue: v}, nil
+	case bool:
+		return &pb.Value{Type: pb.ValueType_VALUE_BOOL, BoolValue: v}, nil
+	case []byte:
+		return &pb.Value{Type: pb.ValueType_VALUE_BYTES, BytesValue: v}, nil
+	default:
+		return nil, fmt.Errorf("unsupported arg type %T", arg)
+	}
+}
+
+// paramsQueryPartBuilder binds params to `?` placeholders of raw condition.
+func paramsQueryPartBuilder(condition string, params []*pb.Value) (query_part string, args []any, err error) {
+	if placeholders := countPlaceholders(condition); placeholders != len(params) {
+		return "", nil, buildQueryPartError("%d placeholders in condition, but %d params passed", placeholders, len(params))
+	}
+	for _, param := range params {
+		var arg any
+		if arg, err = valueParam(param); err != nil {
+			return "", nil, buildQueryPartError("bad condition param: %s", err.Error())
+		} else {
+			args = append(args, arg)
+		}
+	}
+	return condition, args, nil
+}
+
+// literalQueryPartBuilder renders driver arg as inline sql literal,
+// for statements which can't have bound params (view definitions etc.).
+func literalQueryPartBuilder(arg any) (query_part string, err error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		if strings.ContainsAny(v, "\\\x00\x1a") {
+			// backslash meaning depends on NO_BACKSLASH_ESCAPES, hex is unambiguous
+			return "_utf8mb4 X'" + hex.EncodeToString([]byte(v)) + "'", nil
+		} else {
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+		}
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return failBuildQueryPart("can't use %v as literal", v)
+		} else {
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		}
+	case bool:
+		if v {
+			return "TRUE", nil
+		} else {
+			return "FALSE", nil
+		}
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	default:
+		return failBuildQueryPart("unsupported literal type %T", arg)
+	}
+}
+
+// stringLiteralQueryPartBuilder renders plain quoted string for DDL (COMMENT, ENUM values), where
+// charset introducers and hex literals of literalQueryPartBuilder are syntax errors. Backslash meaning
+// depends on NO_BACKSLASH_ESCAPES, so strings with it (or NUL, ^Z) are rejected.
+func stringLiteralQueryPartBuilder(s string) (query_part string, err error) {
+	if strings.ContainsAny(s, "\\\x00\x1a") {
+		return failBuildQueryPart("%q can't contain backslash, NUL or ^Z", s)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
+
+// inlineQueryParams replaces placeholders of query with inline literals of args.
+func inlineQueryParams(query string, args []any) (inlined string, err error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	offsets := []int{}
+	scanPlaceholders(query, func(offset int) { offsets = append(offsets, offset) })
+	if len(offsets) != len(args) {
+		return "", buildQueryError("%d placeholders in query, but %d args passed", len(offsets), len(args))
+	}
+	builder, last := strings.Builder{}, 0
+	for i, offset := range offsets {
+		var literal string
+		if literal, err = literalQueryPartBuilder(args[i]); err != nil {
+			return "", err
+		}
+		builder.WriteString(query[last:offset])
+		builder.WriteString(literal)
+		last = offset + 1
+	}
+	builder.WriteString(query[last:])
+	return builder.String(), nil
+}
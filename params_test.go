@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func TestScanCode(t *testing.T) {
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"a = ?", "a = ?"},
+		{"a = '?' AND b = ?", "a =  AND b = ?"},
+		{`a = 'it''s ?' AND b = ?`, "a =  AND b = ?"},
+		{`a = 'it\'s ?' AND b = ?`, "a =  AND b = ?"},
+		{`a = "x\"?" AND b = ?`, "a =  AND b = ?"},
+		{"`we``ird?` = ?", " = ?"},
+		{"a = ? # comment ?\nAND b", "a = ? AND b"},
+		{"a = ? -- comment ?\nAND b", "a = ? AND b"},
+		{"a = ?--1", "a = ?--1"},
+		{"a /* ? */ = ?", "a  = ?"},
+		{"a = 'unterminated ?", "a = "},
+		{"a /* unterminated ?", "a "},
+	}
+	for _, test := range tests {
+		code := []byte{}
+		scanCode(test.query, func(offset int) { code = append(code, test.query[offset]) })
+		if string(code) != test.code {
+			t.Errorf("scanCode(%q) = %q, want %q", test.query, code, test.code)
+		}
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	if count := countPlaceholders("a = ? AND b = '?' AND c IN (?, ?) /* ? */"); count != 3 {
+		t.Errorf("countPlaceholders = %d, want 3", count)
+	}
+}
+
+func TestLiteralQueryPartBuilder(t *testing.T) {
+	tests := []struct {
+		arg     any
+		literal string
+	}{
+		{nil, "NULL"},
+		{"abc", "'abc'"},
+		{"it's", "'it''s'"},
+		{"'; DROP TABLE x; --", "'''; DROP TABLE x; --'"},
+		{`a\'b`, "_utf8mb4 X'615c2762'"},
+		{"nul\x00", "_utf8mb4 X'6e756c00'"},
+		{int64(-5), "-5"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{1.5, "1.5"},
+		{true, "TRUE"},
+		{false, "FALSE"},
+		{[]byte("\x00'"), "X'0027'"},
+	}
+	for _, test := range tests {
+		if literal, err := literalQueryPartBuilder(test.arg); err != nil || literal != test.literal {
+			t.Errorf("literalQueryPartBuilder(%#v) = %q, %v, want %q", test.arg, literal, err, test.literal)
+		}
+	}
+	for _, arg := range []any{math.NaN(), math.Inf(1), int32(1)} {
+		if literal, err := literalQueryPartBuilder(arg); err == nil {
+			t.Errorf("literalQueryPartBuilder(%#v) = %q, want err", arg, literal)
+		}
+	}
+}
+
+func TestStringLiteralQueryPartBuilder(t *testing.T) {
+	for s, literal := range map[string]string{"": "''", "it's": "'it''s'", "a'), x INT, y ENUM('b": "'a''), x INT, y ENUM(''b'"} {
+		if got, err := stringLiteralQueryPartBuilder(s); err != nil || got != literal {
+			t.Errorf("stringLiteralQueryPartBuilder(%q) = %q, %v, want %q", s, got, err, literal)
+		}
+	}
+	for _, s := range []string{`a\'b`, "nul\x00", "\x1a"} {
+		if got, err := stringLiteralQueryPartBuilder(s); err == nil {
+			t.Errorf("stringLiteralQueryPartBuilder(%q) = %q, want err", s, got)
+		}
+	}
+}
+
+func TestInlineQueryParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		args    []any
+		inlined string
+	}{
+		{"SELECT 1", nil, "SELECT 1"},
+		{"a = ? AND b = ?", []any{int64(1), "x'y"}, "a = 1 AND b = 'x''y'"},
+		{"a = '?' AND b = ?", []any{"?"}, "a = '?' AND b = '?'"},
+		{"a /* ? */ = ?", []any{nil}, "a /* ? */ = NULL"},
+	}
+	for _, test := range tests {
+		if inlined, err := inlineQueryParams(test.query, test.args); err != nil || inlined != test.inlined {
+			t.Errorf("inlineQueryParams(%q) = %q, %v, want %q", test.query, inlined, err, test.inlined)
+		}
+	}
+	if _, err := inlineQueryParams("a = ?", []any{int64(1), int64(2)}); err == nil {
+		t.Errorf("inlineQueryParams: want err on arg count mismatch")
+	}
+}
+
+func TestParamsQueryPartBuilder(t *testing.T) {
+	params := []*pb.Value{
+		{Type: pb.ValueType_VALUE_STRING, StringValue: "x'y"},
+		{Type: pb.ValueType_VALUE_NULL},
+	}
+	if condition, args, err := paramsQueryPartBuilder("a = ? AND b <=> ?", params); err != nil || condition != "a = ? AND b <=> ?" || len(args) != 2 || args[0] != "x'y" || args[1] != nil {
+		t.Errorf("paramsQueryPartBuilder = %q, %#v, %v", condition, args, err)
+	}
+	if _, _, err := paramsQueryPartBuilder("a = ?", nil); err == nil {
+		t.Errorf("paramsQueryPartBuilder: want err on param count mismatch")
+	}
+	if _, _, err := paramsQueryPartBuilder("a = ?", []*pb.Value{{Type: pb.ValueType_VALUE_EXPR, Expr: "1"}}); err == nil {
+		t.Errorf("paramsQueryPartBuilder: want err on expr param")
+	}
+}
+
+func TestValueParamRoundTrip(t *testing.T) {
+	values := []*pb.Value{
+		{Type: pb.ValueType_VALUE_NULL},
+		{Type: pb.ValueType_VALUE_STRING, StringValue: "x"},
+		{Type: pb.ValueType_VALUE_INT, IntValue: -1},
+		{Type: pb.ValueType_VALUE_UINT, UintValue: 1},
+		{Type: pb.ValueType_VALUE_DOUBLE, DoubleValue: 0.5},
+		{Type: pb.ValueType_VALUE_BOOL, BoolValue: true},
+		{Type: pb.ValueType_VALUE_BYTES, BytesValue: []byte{0, 1}},
+	}
+	for _, value := range values {
+		if arg, err := valueParam(value); err != nil {
+			t.Errorf("valueParam(%s): %s", value.GetType().String(), err)
+		} else if back, err := argValue(arg); err != nil {
+			t.Errorf("argValue(%#v): %s", arg, err)
+		} else if back.GetType() != value.GetType() {
+			t.Errorf("argValue(valueParam(%s)) type = %s", value.GetType().String(), back.GetType().String())
+		}
+	}
+}
@@ -7,24 +7,34 @@ import (
 	pb "greateapot.re/dblabs-api"
 )
 
-func failBuildQuery(format string, a ...any) (query string, err error) {
-	return "", fmt.Errorf("error while building query: %s", fmt.Sprintf(format, a...))
+func buildQueryError(format string, a ...any) error {
+	return fmt.Errorf("error while building query: %s", fmt.Sprintf(format, a...))
 }
 
-func alterDatabaseQueryBuilder(request *pb.AlterDatabaseRequest) (query string, err error) {
+func failBuildQuery(format string, a ...any) (query string, args []any, err error) {
+	return "", nil, buildQueryError(format, a...)
+}
+
+func alterDatabaseQueryBuilder(request *pb.AlterDatabaseRequest) (query string, args []any, err error) {
+	var database_name string
 	if request.GetDatabaseName() == "" {
 		return failBuildQuery("no db name")
+	} else if database_name, err = quoteIdentifier(request.GetDatabaseName()); err != nil {
+		return "", nil, err
 	} else {
 		return fmt.Sprintf(
 			"ALTER DATABASE %s %s;",
-			request.GetDatabaseName(),
+			database_name,
 			readOnlyQueryPartBuilder(request.GetReadOnly()),
-		), nil
+		), nil, nil
 	}
 }
-func alterTableQueryBuilder(request *pb.AlterTableRequest) (query string, err error) {
+func alterTableQueryBuilder(request *pb.AlterTableRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else if len(request.GetOptions()) == 0 {
 		return failBuildQuery("table option is empty")
 	} else {
@@ -61,29 +71,49 @@ func alterTableQueryBuilder(request *pb.AlterTableRequest) (query string, err er
 				query_part, err = dropKeyQueryPartBuilder(option.GetDropKey())
 			case pb.AlterTableOptionType_ALTER_COLUMN:
 				query_part, err = alterColumnQueryPartBuilder(option.GetAlterColumn())
+			case pb.AlterTableOptionType_ADD_INDEX:
+				query_part, err = addIndexQueryPartBuilder(option.GetAddIndex())
+			case pb.AlterTableOptionType_DROP_INDEX:
+				query_part, err = dropIndexQueryPartBuilder(option.GetDropIndex())
+			case pb.AlterTableOptionType_ALTER_INDEX:
+				query_part, err = alterIndexQueryPartBuilder(option.GetAlterIndex())
+			case pb.AlterTableOptionType_ADD_CHECK:
+				query_part, err = addCheckQueryPartBuilder(option.GetAddCheck())
+			case pb.AlterTableOptionType_DROP_CHECK:
+				query_part, err = dropCheckQueryPartBuilder(option.GetDropCheck())
+			case pb.AlterTableOptionType_ALTER_CHECK:
+				query_part, err = alterCheckQueryPartBuilder(option.GetAlterCheck())
+			case pb.AlterTableOptionType_TABLE_OPTIONS:
+				query_part, err = tableOptionsQueryPartBuilder(option.GetTableOptions())
 			default:
 				return failBuildQuery("unknown option type passed")
 			}
 			if err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query_parts = append(query_parts, query_part)
 			}
 		}
 
-		return fmt.Sprintf("ALTER TABLE %s %s;", request.GetTableName(), strings.Join(query_parts, ", ")), nil
+		return fmt.Sprintf("ALTER TABLE %s %s;", table_name, strings.Join(query_parts, ", ")), nil, nil
 	}
 }
-func createDatabaseQueryBuilder(request *pb.CreateDatabaseRequest) (query string, err error) {
+func createDatabaseQueryBuilder(request *pb.CreateDatabaseRequest) (query string, args []any, err error) {
+	var database_name string
 	if request.GetDatabaseName() == "" {
 		return failBuildQuery("no db name")
+	} else if database_name, err = quoteIdentifier(request.GetDatabaseName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("CREATE DATABASE %s;", request.GetDatabaseName()), nil
+		return fmt.Sprintf("CREATE DATABASE %s;", database_name), nil, nil
 	}
 }
-func createTableQueryBuilder(request *pb.CreateTableRequest) (query string, err error) {
+func createTableQueryBuilder(request *pb.CreateTableRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else if len(request.GetOptions()) == 0 {
 		return failBuildQuery("table options is empty")
 	} else {
@@ -104,64 +134,111 @@ func createTableQueryBuilder(request *pb.CreateTableRequest) (query string, err
 				query_part, err = asQueryPartBuilder(option.GetAs())
 			case pb.CreateTableOptionType_LIKE:
 				query_part, err = likeQueryPartBuilder(option.GetLike())
+			case pb.CreateTableOptionType_CHECK:
+				query_part, err = checkQueryPartBuilder(option.GetCheck())
 			default:
 				return failBuildQuery("unknown option type passed")
 			}
 			if err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query_parts = append(query_parts, query_part)
 			}
 		}
 
-		return fmt.Sprintf("CREATE TABLE %s(%s);", request.GetTableName(), strings.Join(query_parts, ", ")), nil
+		create_table := "CREATE TABLE"
+		if request.GetTemporary() {
+			create_table = "CREATE TEMPORARY TABLE"
+		}
+		if request.GetIfNotExists() {
+			create_table += " IF NOT EXISTS"
+		}
+		table_options := ""
+		if request.GetTableOptions() != nil {
+			if table_options, err = tableOptionsQueryPartBuilder(request.GetTableOptions()); err != nil {
+				return "", nil, err
+			} else {
+				table_options = " " + table_options
+			}
+		}
+
+		return fmt.Sprintf("%s %s(%s)%s;", create_table, table_name, strings.Join(query_parts, ", "), table_options), nil, nil
 	}
 }
-func dropDatabaseQueryBuilder(request *pb.DropDatabaseRequest) (query string, err error) {
+func dropDatabaseQueryBuilder(request *pb.DropDatabaseRequest) (query string, args []any, err error) {
+	var database_name string
 	if request.GetDatabaseName() == "" {
 		return failBuildQuery("no db name")
+	} else if database_name, err = quoteIdentifier(request.GetDatabaseName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("DROP DATABASE %s;", request.GetDatabaseName()), nil
+		return fmt.Sprintf("DROP DATABASE %s;", database_name), nil, nil
 	}
 }
-func dropTableQueryBuilder(request *pb.DropTableRequest) (query string, err error) {
+func dropTableQueryBuilder(request *pb.DropTableRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("DROP TABLE %s;", request.GetTableName()), nil
+		return fmt.Sprintf("DROP TABLE %s;", table_name), nil, nil
 	}
 }
-func renameTableQueryBuilder(request *pb.RenameTableRequest) (query string, err error) {
+func renameTableQueryBuilder(request *pb.RenameTableRequest) (query string, args []any, err error) {
+	var old_table_name, new_table_name string
 	if request.GetOldTableName() == "" {
 		return failBuildQuery("no old table name")
 	} else if request.GetNewTableName() == "" {
 		return failBuildQuery("no new table name")
+	} else if old_table_name, err = quoteSchemaObjectName(request.GetOldTableName()); err != nil {
+		return "", nil, err
+	} else if new_table_name, err = quoteSchemaObjectName(request.GetNewTableName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("RENAME TABLE %s TO %s;", request.GetOldTableName(), request.GetNewTableName()), nil
+		return fmt.Sprintf("RENAME TABLE %s TO %s;", old_table_name, new_table_name), nil, nil
 	}
 }
-func truncateTableQueryBuilder(request *pb.TruncateTableRequest) (query string, err error) {
+func truncateTableQueryBuilder(request *pb.TruncateTableRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("TRUNCATE TABLE %s;", request.GetTableName()), nil
+		return fmt.Sprintf("TRUNCATE TABLE %s;", table_name), nil, nil
 	}
 }
-func deleteQueryBuilder(request *pb.DeleteRequest) (query string, err error) {
+func deleteQueryBuilder(request *pb.DeleteRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else {
-		query = "DELETE FROM " + request.GetTableName()
+		query = "DELETE FROM " + table_name
 		if request.GetTableAlias() != "" {
-			query += " AS " + request.GetTableAlias()
+			var table_alias string
+			if table_alias, err = quoteIdentifier(request.GetTableAlias()); err != nil {
+				return "", nil, err
+			} else {
+				query += " AS " + table_alias
+			}
 		}
-		if request.GetWhereCondition() != "" {
-			query += " WHERE " + request.GetWhereCondition()
+		if request.GetWhereCondition() != "" || len(request.GetWhereParams()) > 0 || request.GetWhereExpr() != nil {
+			var where_condition string
+			var where_args []any
+			if where_condition, where_args, err = conditionQueryPartBuilder(request.GetWhereCondition(), request.GetWhereParams(), request.GetWhereExpr()); err != nil {
+				return "", nil, err
+			} else {
+				query += " WHERE " + where_condition
+				args = append(args, where_args...)
+			}
 		}
 		if request.GetOrderBy() != nil {
 			var order_by string
 			if order_by, err = orderByQueryPartBuilder(request.GetOrderBy()); err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query += " " + order_by
 			}
@@ -172,21 +249,30 @@ func deleteQueryBuilder(request *pb.DeleteRequest) (query string, err error) {
 		return
 	}
 }
-func updateQueryBuilder(request *pb.UpdateRequest) (query string, err error) {
-	var assignments string
+func updateQueryBuilder(request *pb.UpdateRequest) (query string, args []any, err error) {
+	var table_name, assignments string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
-	} else if assignments, err = assignmentListQueryPartBuilder(request.GetAssignmentList()); err != nil {
-		return "", err
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
+	} else if assignments, args, err = assignmentListQueryPartBuilder(request.GetAssignmentList()); err != nil {
+		return "", nil, err
 	} else {
-		query = fmt.Sprintf("UPDATE %s SET %s", request.GetTableName(), assignments)
-		if request.GetWhereCondition() != "" {
-			query += " WHERE " + request.GetWhereCondition()
+		query = fmt.Sprintf("UPDATE %s SET %s", table_name, assignments)
+		if request.GetWhereCondition() != "" || len(request.GetWhereParams()) > 0 || request.GetWhereExpr() != nil {
+			var where_condition string
+			var where_args []any
+			if where_condition, where_args, err = conditionQueryPartBuilder(request.GetWhereCondition(), request.GetWhereParams(), request.GetWhereExpr()); err != nil {
+				return "", nil, err
+			} else {
+				query += " WHERE " + where_condition
+				args = append(args, where_args...)
+			}
 		}
 		if request.GetOrderBy() != nil {
 			var order_by string
 			if order_by, err = orderByQueryPartBuilder(request.GetOrderBy()); err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query += " " + order_by
 			}
@@ -197,107 +283,182 @@ func updateQueryBuilder(request *pb.UpdateRequest) (query string, err error) {
 		return
 	}
 }
-func insertQueryBuilder(request *pb.InsertRequest) (query string, err error) {
+func insertQueryBuilder(request *pb.InsertRequest) (query string, args []any, err error) {
+	var table_name string
 	if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else {
-		query = "INSERT INTO " + request.GetTableName()
+		query = "INSERT INTO " + table_name
 		if len(request.GetColumnNames()) > 0 {
-			query += fmt.Sprintf("(%s)", strings.Join(request.GetColumnNames(), ", "))
+			var column_names string
+			if column_names, err = quoteIdentifierList(request.GetColumnNames(), quoteIdentifier); err != nil {
+				return "", nil, err
+			} else {
+				query += fmt.Sprintf("(%s)", column_names)
+			}
 		}
 		switch request.GetInsertType() {
 		case pb.InsertType_SELECT:
 			var select_data string
-			if select_data, err = selectDataQueryPartBuilder(request.GetSelectData(), false); err != nil {
-				return "", err
+			var select_args []any
+			if select_data, select_args, err = selectStatementQueryPartBuilder(request.GetSelectData(), request.GetCompoundSelect()); err != nil {
+				return "", nil, err
 			} else {
 				query += " " + select_data
+				args = append(args, select_args...)
 			}
 		case pb.InsertType_TABLE:
+			var other_table_name string
 			if request.GetOtherTableName() == "" {
 				return failBuildQuery("no other table name")
+			} else if other_table_name, err = quoteSchemaObjectName(request.GetOtherTableName()); err != nil {
+				return "", nil, err
 			} else {
-				query += " TABLE " + request.GetOtherTableName()
+				query += " TABLE " + other_table_name
 			}
 		case pb.InsertType_VALUES:
 			var values string
-			if values, err = rowConstructorListQueryPartBuilder(request.GetRowConstructorList()); err != nil {
-				return "", err
+			var values_args []any
+			if values, values_args, err = rowConstructorListQueryPartBuilder(request.GetRowConstructorList()); err != nil {
+				return "", nil, err
 			} else {
 				query += " VALUES " + values
+				args = append(args, values_args...)
 			}
 		default:
 			return failBuildQuery("unknown insert type")
 		}
 		if request.GetOnDuplicateKeyUpdate() != nil {
 			var assignment_list string
-			if assignment_list, err = assignmentListQueryPartBuilder(request.GetOnDuplicateKeyUpdate()); err != nil {
-				return "", nil
+			var assignment_args []any
+			if assignment_list, assignment_args, err = assignmentListQueryPartBuilder(request.GetOnDuplicateKeyUpdate()); err != nil {
+				return "", nil, err
 			} else {
 				query += " ON DUPLICATE KEY UPDATE " + assignment_list
+				args = append(args, assignment_args...)
 			}
 		}
 		return
 	}
 }
-func selectQueryBuilder(request *pb.SelectRequest) (query string, err error) {
-	return selectDataQueryPartBuilder(request.GetSelectData(), true)
+func selectQueryBuilder(request *pb.SelectRequest) (query string, args []any, err error) {
+	if request.GetCompoundSelect() != nil {
+		if selectPaginated(request) {
+			return failBuildQuery("compound select can't be paginated")
+		}
+		return selectStatementQueryPartBuilder(request.GetSelectData(), request.GetCompoundSelect())
+	} else if selectPaginated(request) && (request.GetSelectData().GetLimit() == 0 || len(request.GetSelectData().GetOrderBy().GetColumnNames()) == 0) {
+		return failBuildQuery("pagination requires limit and order by col names")
+	}
+	return pagedSelectDataQueryPartBuilder(request.GetSelectData(), selectPaginated(request), request.GetPageToken())
 }
-func joinQueryBuilder(request *pb.JoinRequest) (query string, err error) {
-	if len(request.GetColumnNames()) == 0 {
-		return failBuildQuery("col names is empty")
-	} else if request.GetFirstTableName() == "" {
+func joinQueryBuilder(request *pb.JoinRequest) (query string, args []any, err error) {
+	// legacy second table + join is the first clause of the chain
+	join_clauses := request.GetJoinClauses()
+	if request.GetSecondTableName() != "" || request.GetJoin() != nil {
+		join_clauses = append([]*pb.JoinClause{{
+			TableName:  request.GetSecondTableName(),
+			TableAlias: request.GetSecondTableAlias(),
+			Join:       request.GetJoin(),
+		}}, join_clauses...)
+	}
+	if request.GetFirstTableName() == "" {
 		return failBuildQuery("no first table name")
-	} else if request.GetSecondTableName() == "" {
-		return failBuildQuery("no second table name")
-	} else if request.GetJoin() == nil {
-		return failBuildQuery("no join data")
+	} else if len(join_clauses) == 0 {
+		return failBuildQuery("join clauses is empty")
 	} else {
-		is_join_specification_required := false
-		query = fmt.Sprintf("SELECT JSON_ARRAYAGG(JSON_ARRAY(%s)) FROM %s", strings.Join(request.GetColumnNames(), ", "), request.GetFirstTableName())
+		var column_names, first_table_name string
+		if column_names, err = selectExprQueryPartBuilder(request.GetColumnNames(), request.GetSelectItems()); err != nil {
+			return "", nil, err
+		} else if first_table_name, err = quoteSchemaObjectName(request.GetFirstTableName()); err != nil {
+			return "", nil, err
+		}
 		if request.GetFirstTableAlias() != "" {
-			query += " AS " + request.GetFirstTableAlias()
+			var first_table_alias string
+			if first_table_alias, err = quoteIdentifier(request.GetFirstTableAlias()); err != nil {
+				return "", nil, err
+			} else {
+				first_table_name += " AS " + first_table_alias
+			}
 		}
-		switch request.GetJoin().GetJoinType() {
-		case pb.JoinType_INNER, pb.JoinType_CROSS:
-			query += fmt.Sprintf(" %s JOIN", request.GetJoin().GetJoinType().String())
-		case pb.JoinType_LEFT, pb.JoinType_RIGHT:
-			is_join_specification_required = true
-			query += fmt.Sprintf(" %s OUTER JOIN", request.GetJoin().GetJoinType().String())
-		default:
-			return failBuildQuery("unknown join type")
+		var where_condition string
+		var where_args []any
+		if request.GetWhereCondition() != "" || len(request.GetWhereParams()) > 0 || request.GetWhereExpr() != nil {
+			if where_condition, where_args, err = conditionQueryPartBuilder(request.GetWhereCondition(), request.GetWhereParams(), request.GetWhereExpr()); err != nil {
+				return "", nil, err
+			}
 		}
-		query += " " + request.GetSecondTableName()
-		if request.GetSecondTableAlias() != "" {
-			query += " AS " + request.GetSecondTableAlias()
+		if len(join_clauses) == 1 && join_clauses[0].GetJoin().GetJoinType() == pb.JoinType_FULL {
+			if request.GetGroupByExpr() != "" || request.GetHavingCondition() != "" || request.GetHavingExpr() != nil {
+				return failBuildQuery("group by and having aren't supported with full join")
+			}
+			var left_join, right_join, anti_join string
+			var join_args []any
+			if left_join, right_join, anti_join, join_args, err = fullJoinQueryPartBuilder(first_table_name, join_clauses[0]); err != nil {
+				return "", nil, err
+			}
+			left_query := fmt.Sprintf("SELECT %s FROM %s %s", column_names, first_table_name, left_join)
+			right_query := fmt.Sprintf("SELECT %s FROM %s %s WHERE %s", column_names, first_table_name, right_join, anti_join)
+			left_args := append([]any{}, join_args...)
+			right_args := append(append([]any{}, join_args...), join_args...)
+			if where_condition != "" {
+				left_query += " WHERE " + where_condition
+				right_query += " AND (" + where_condition + ")"
+				left_args = append(left_args, where_args...)
+				right_args = append(right_args, where_args...)
+			}
+			args = append(left_args, right_args...)
+			// order by of the union can only refer to result column names
+			query = fmt.Sprintf("(%s) UNION ALL (%s)", left_query, right_query)
+		} else {
+			query = fmt.Sprintf("SELECT %s FROM %s", column_names, first_table_name)
+			for _, join_clause := range join_clauses {
+				var join string
+				var join_args []any
+				if join, join_args, err = joinClauseQueryPartBuilder(join_clause); err != nil {
+					return "", nil, err
+				} else {
+					query += " " + join
+					args = append(args, join_args...)
+				}
+			}
+			if where_condition != "" {
+				query += " WHERE " + where_condition
+				args = append(args, where_args...)
+			}
+		}
+		if request.GetGroupByExpr() != "" {
+			query += " GROUP BY " + request.GetGroupByExpr()
 		}
-		if is_join_specification_required && request.GetJoin().GetJoinSpecification() == nil {
-			return failBuildQuery("no join spec for this join type")
-		} else if request.GetJoin().GetJoinSpecification() != nil {
-			var join_specification string
-			if join_specification, err = joinSpecificationQueryPartBuilder(request.Join.GetJoinSpecification()); err != nil {
-				return "", err
+		if request.GetHavingCondition() != "" || len(request.GetHavingParams()) > 0 || request.GetHavingExpr() != nil {
+			var having_condition string
+			var having_args []any
+			if having_condition, having_args, err = conditionQueryPartBuilder(request.GetHavingCondition(), request.GetHavingParams(), request.GetHavingExpr()); err != nil {
+				return "", nil, err
 			} else {
-				query += " " + join_specification
+				query += " HAVING " + having_condition
+				args = append(args, having_args...)
 			}
 		}
-		if request.GetWhereCondition() != "" {
-			query += " WHERE " + request.GetWhereCondition()
-		}
 		if request.GetOrderBy() != nil {
 			var order_by string
 			if order_by, err = orderByQueryPartBuilder(request.GetOrderBy()); err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query += " " + order_by
 			}
 		}
+		if request.GetLimit() != 0 {
+			query += fmt.Sprintf(" LIMIT %d", request.GetLimit())
+		}
 		return
 	}
 }
-func showDatabasesQueryBuilder(request *pb.ShowDatabasesRequest) (query string, err error) {
+func showDatabasesQueryBuilder(request *pb.ShowDatabasesRequest) (query string, args []any, err error) {
 	/*
-		select json_arrayagg(json_array(SCHEMA_NAME)) from INFORMATION_SCHEMA.SCHEMATA;
+		select SCHEMA_NAME from INFORMATION_SCHEMA.SCHEMATA;
 		WHERE SCHEMA_NAME != 'sys' AND SCHEMA_NAME != 'information_schema'
 		AND SCHEMA_NAME != 'performance_schema' AND SCHEMA_NAME != 'mysql';
 	*/
@@ -310,81 +471,106 @@ func showDatabasesQueryBuilder(request *pb.ShowDatabasesRequest) (query string,
 		TableName:      "INFORMATION_SCHEMA.SCHEMATA",
 		ColumnNames:    []string{"SCHEMA_NAME"},
 		WhereCondition: where_condition,
-	}, true)
+	})
 }
-func showTablesQueryBuilder(request *pb.ShowTablesRequest) (query string, err error) {
-	//  select json_arrayagg(json_array(TABLE_NAME)) from INFORMATION_SCHEMA.TABLES where TABLE_SCHEMA = '%s';
+func showTablesQueryBuilder(request *pb.ShowTablesRequest) (query string, args []any, err error) {
+	//  select TABLE_NAME from INFORMATION_SCHEMA.TABLES where TABLE_SCHEMA = ?;
 	if request.GetDatabaseName() == "" {
 		return failBuildQuery("no db name")
+	} else if err = validateIdentifier(request.GetDatabaseName()); err != nil {
+		return "", nil, err
 	} else {
 		return selectDataQueryPartBuilder(&pb.SelectData{
 			TableName:      "INFORMATION_SCHEMA.TABLES",
 			ColumnNames:    []string{"TABLE_NAME"},
-			WhereCondition: fmt.Sprintf("TABLE_SCHEMA = '%s'", request.GetDatabaseName()),
-		}, true)
+			WhereCondition: "TABLE_SCHEMA = ?",
+			WhereParams: []*pb.Value{
+				{Type: pb.ValueType_VALUE_STRING, StringValue: request.GetDatabaseName()},
+			},
+		})
 	}
 }
-func showTableStructQueryBuilder(request *pb.ShowTableStructRequest) (query string, err error) {
+func showTableStructQueryBuilder(request *pb.ShowTableStructRequest) (query string, args []any, err error) {
 	/*
-		SELECT json_arrayagg(json_array(COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA))
-		FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s';
+		SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA
+		FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?;
 	*/
 	if request.GetDatabaseName() == "" {
 		return failBuildQuery("no db name")
 	} else if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if err = validateIdentifier(request.GetDatabaseName()); err != nil {
+		return "", nil, err
+	} else if err = validateIdentifier(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else {
 		return selectDataQueryPartBuilder(&pb.SelectData{
-			TableName:   "INFORMATION_SCHEMA.COLUMNS",
-			ColumnNames: []string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA"},
-			WhereCondition: fmt.Sprintf(
-				"TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s'",
-				request.GetDatabaseName(),
-				request.GetTableName(),
-			),
-		}, true)
+			TableName:      "INFORMATION_SCHEMA.COLUMNS",
+			ColumnNames:    []string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA"},
+			WhereCondition: "TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+			WhereParams: []*pb.Value{
+				{Type: pb.ValueType_VALUE_STRING, StringValue: request.GetDatabaseName()},
+				{Type: pb.ValueType_VALUE_STRING, StringValue: request.GetTableName()},
+			},
+		})
 	}
 }
-func dropTriggerQueryBuilder(request *pb.DropTriggerRequest) (query string, err error) {
+func dropTriggerQueryBuilder(request *pb.DropTriggerRequest) (query string, args []any, err error) {
+	var trigger_name string
 	if request.GetTriggerName() == "" {
 		return failBuildQuery("no trigger name")
+	} else if trigger_name, err = quoteSchemaObjectName(request.GetTriggerName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("DROP TRIGGER %s", request.GetTriggerName()), nil
+		return fmt.Sprintf("DROP TRIGGER %s", trigger_name), nil, nil
 	}
 }
-func createTriggerQueryBuilder(request *pb.CreateTriggerRequest) (query string, err error) {
+func createTriggerQueryBuilder(request *pb.CreateTriggerRequest) (query string, args []any, err error) {
 	// CREATE TRIGGER trigger_name trigger_time trigger_event ON tbl_name FOR EACH ROW [trigger_order] trigger_body
+	var trigger_name, table_name string
 	if request.GetTriggerName() == "" {
 		return failBuildQuery("no trigger name")
 	} else if request.GetTableName() == "" {
 		return failBuildQuery("no table name")
+	} else if trigger_name, err = quoteSchemaObjectName(request.GetTriggerName()); err != nil {
+		return "", nil, err
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
 	} else if request.GetTriggerBody() == "" {
 		return failBuildQuery("no trigger body")
 	} else {
 		trigger_order := ""
 		if request.GetTriggerOrder() != nil {
 			if trigger_order, err = triggerOrderQueryPartBuilder(request.GetTriggerOrder()); err != nil {
-				return "", err
+				return "", nil, err
 			}
 		}
 		return fmt.Sprintf(
 			"CREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s BEGIN %s END",
-			request.GetTriggerName(),
+			trigger_name,
 			strings.Split(request.GetTriggerTime().String(), "_")[0], // proto-кастыли
 			request.GetTriggerEvent().String(),
-			request.GetTableName(),
+			table_name,
 			trigger_order,
 			request.GetTriggerBody(),
-		), nil
+		), nil, nil
 	}
 }
-func createViewQueryBuilder(request *pb.CreateViewRequest) (query string, err error) {
+func createViewQueryBuilder(request *pb.CreateViewRequest) (query string, args []any, err error) {
+	var viewName string
 	if request.GetViewName() == "" {
 		return failBuildQuery("no view name")
+	} else if viewName, err = quoteSchemaObjectName(request.GetViewName()); err != nil {
+		return "", nil, err
 	} else {
-		var selectData, orReplace string
-		if selectData, err = selectDataQueryPartBuilder(request.GetSelectData(), false); err != nil {
-			return "", err
+		var selectData, orReplace, columnNames string
+		var selectArgs []any
+		if selectData, selectArgs, err = selectStatementQueryPartBuilder(request.GetSelectData(), request.GetCompoundSelect()); err != nil {
+			return "", nil, err
+		} else if selectData, err = inlineQueryParams(selectData, selectArgs); err != nil {
+			return "", nil, err // view definition can't contain params
+		} else if columnNames, err = quoteIdentifierList(request.GetColumnList(), quoteIdentifier); err != nil {
+			return "", nil, err
 		}
 		if request.GetOrReplace() {
 			orReplace = "OR REPLACE"
@@ -392,8 +578,7 @@ func createViewQueryBuilder(request *pb.CreateViewRequest) (query string, err er
 			orReplace = ""
 		}
 		algorithm := viewAlgorithmTypeQueryPartBuilder(request.GetAlgorithm())
-		withCheckOption := viewWithCheckOptionTypeQueryPartBuilder(request.GetWithCheckOption())
-		columnNames := strings.Join(request.GetColumnList(), ", ")
+		withCheckOption := viewWithCheckOptionTypeQueryPartBuilder(request.GetWithCheckOption(), request.GetAlgorithm(), request.GetSelectData(), request.GetCompoundSelect())
 		if columnNames != "" {
 			columnNames = fmt.Sprintf("(%s)", columnNames)
 		}
@@ -401,57 +586,70 @@ func createViewQueryBuilder(request *pb.CreateViewRequest) (query string, err er
 			"CREATE %s %s VIEW %s %s AS %s %s",
 			orReplace,
 			algorithm,
-			request.GetViewName(),
+			viewName,
 			columnNames,
 			selectData,
 			withCheckOption,
-		), nil
+		), nil, nil
 	}
 }
-func alterViewQueryBuilder(request *pb.AlterViewRequest) (query string, err error) {
+func alterViewQueryBuilder(request *pb.AlterViewRequest) (query string, args []any, err error) {
+	var viewName string
 	if request.GetViewName() == "" {
 		return failBuildQuery("no view name")
+	} else if viewName, err = quoteSchemaObjectName(request.GetViewName()); err != nil {
+		return "", nil, err
 	} else {
-		var selectData string
-		if selectData, err = selectDataQueryPartBuilder(request.GetSelectData(), false); err != nil {
-			return "", err
+		var selectData, columnNames string
+		var selectArgs []any
+		if selectData, selectArgs, err = selectStatementQueryPartBuilder(request.GetSelectData(), request.GetCompoundSelect()); err != nil {
+			return "", nil, err
+		} else if selectData, err = inlineQueryParams(selectData, selectArgs); err != nil {
+			return "", nil, err // view definition can't contain params
+		} else if columnNames, err = quoteIdentifierList(request.GetColumnList(), quoteIdentifier); err != nil {
+			return "", nil, err
 		}
 		algorithm := viewAlgorithmTypeQueryPartBuilder(request.GetAlgorithm())
-		withCheckOption := viewWithCheckOptionTypeQueryPartBuilder(request.GetWithCheckOption())
-		columnNames := strings.Join(request.GetColumnList(), ", ")
+		withCheckOption := viewWithCheckOptionTypeQueryPartBuilder(request.GetWithCheckOption(), request.GetAlgorithm(), request.GetSelectData(), request.GetCompoundSelect())
 		if columnNames != "" {
 			columnNames = fmt.Sprintf("(%s)", columnNames)
 		}
 		return fmt.Sprintf(
 			"ALTER %s VIEW %s %s AS %s %s",
 			algorithm,
-			request.GetViewName(),
+			viewName,
 			columnNames,
 			selectData,
 			withCheckOption,
-		), nil
+		), nil, nil
 	}
 }
-func dropViewQueryBuilder(request *pb.DropViewRequest) (query string, err error) {
+func dropViewQueryBuilder(request *pb.DropViewRequest) (query string, args []any, err error) {
+	var view_name string
 	if request.GetViewName() == "" {
 		return failBuildQuery("no view name")
+	} else if view_name, err = quoteSchemaObjectName(request.GetViewName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("DROP VIEW %s", request.GetViewName()), nil
+		return fmt.Sprintf("DROP VIEW %s", view_name), nil, nil
 	}
 }
-func createProcedureQueryBuilder(request *pb.CreateProcedureRequest) (query string, err error) {
+func createProcedureQueryBuilder(request *pb.CreateProcedureRequest) (query string, args []any, err error) {
+	var procedure_name string
 	if request.GetProcedureName() == "" {
 		return failBuildQuery("no procedure name")
+	} else if procedure_name, err = quoteSchemaObjectName(request.GetProcedureName()); err != nil {
+		return "", nil, err
 	} else if request.GetRoutineBody() == "" {
 		return failBuildQuery("no procedure routine body")
 	} else {
-		query = "CREATE PROCEDURE " + request.GetProcedureName()
+		query = "CREATE PROCEDURE " + procedure_name
 		if len(request.GetProcedureParameters()) > 0 {
 			pps := []string{}
 			for _, procedure_parameter := range request.GetProcedureParameters() {
 				var pp string
 				if pp, err = procedureParameterQueryPartBuilder(procedure_parameter); err != nil {
-					return "", err
+					return "", nil, err
 				} else {
 					pps = append(pps, pp)
 				}
@@ -462,26 +660,140 @@ func createProcedureQueryBuilder(request *pb.CreateProcedureRequest) (query stri
 		return
 	}
 }
-func dropProcedureQueryBuilder(request *pb.DropProcedureRequest) (query string, err error) {
+func dropProcedureQueryBuilder(request *pb.DropProcedureRequest) (query string, args []any, err error) {
+	var procedure_name string
 	if request.GetProcedureName() == "" {
-		return failBuildQuery("no view name")
+		return failBuildQuery("no procedure name")
+	} else if procedure_name, err = quoteSchemaObjectName(request.GetProcedureName()); err != nil {
+		return "", nil, err
 	} else {
-		return fmt.Sprintf("DROP PROCEDURE %s", request.GetProcedureName()), nil
+		return fmt.Sprintf("DROP PROCEDURE %s", procedure_name), nil, nil
 	}
 }
-func setQueryBuilder(request *pb.SetRequest) (query string, err error) {
+func setQueryBuilder(request *pb.SetRequest) (query string, args []any, err error) {
 	if request.GetVarName() == "" {
 		return failBuildQuery("no set var name")
 	} else if request.GetExpr() == "" {
 		return failBuildQuery("no set expr")
 	} else {
-		return fmt.Sprintf("SET %s = %s", request.GetVarName(), request.GetExpr()), nil
+		return fmt.Sprintf("SET %s = %s", request.GetVarName(), request.GetExpr()), nil, nil
 	}
 }
-func callProcedureQueryBuilder(request *pb.CallProcedureRequest) (query string, err error) {
+func callProcedureQueryBuilder(request *pb.CallProcedureRequest) (query string, args []any, err error) {
 	if request.GetExpr() == "" {
 		return failBuildQuery("no expr")
 	} else {
-		return fmt.Sprintf("CALL %s", request.GetExpr()), nil
+		return fmt.Sprintf("CALL %s", request.GetExpr()), nil, nil
+	}
+}
+func createIndexQueryBuilder(request *pb.CreateIndexRequest) (query string, args []any, err error) {
+	var table_name, index_name, index_type, key_parts, index_options, algorithm_lock string
+	if request.GetTableName() == "" {
+		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
+	} else if request.GetIndex() == nil {
+		return failBuildQuery("no index data")
+	} else if request.GetIndex().GetIndexName() == "" {
+		return failBuildQuery("no index name")
+	} else if index_name, err = quoteIdentifier(request.GetIndex().GetIndexName()); err != nil {
+		return "", nil, err
+	} else if index_type, err = indexTypeQueryPartBuilder(request.GetIndex().GetType()); err != nil {
+		return "", nil, err
+	} else if key_parts, err = indexKeyPartListQueryPartBuilder(request.GetIndex().GetKeyParts()); err != nil {
+		return "", nil, err
+	} else if index_options, err = indexOptionsQueryPartBuilder(request.GetIndex().GetOptions()); err != nil {
+		return "", nil, err
+	} else if algorithm_lock, err = indexAlgorithmLockQueryPartBuilder(request.GetAlgorithm(), request.GetLock()); err != nil {
+		return "", nil, err
+	} else {
+		return fmt.Sprintf(
+			"CREATE %s %s ON %s (%s) %s %s",
+			index_type,
+			index_name,
+			table_name,
+			key_parts,
+			index_options,
+			algorithm_lock,
+		), nil, nil
+	}
+}
+func dropIndexQueryBuilder(request *pb.DropIndexRequest) (query string, args []any, err error) {
+	var table_name, index_name, algorithm_lock string
+	if request.GetTableName() == "" {
+		return failBuildQuery("no table name")
+	} else if table_name, err = quoteSchemaObjectName(request.GetTableName()); err != nil {
+		return "", nil, err
+	} else if request.GetIndexName() == "" {
+		return failBuildQuery("no index name")
+	} else if index_name, err = quoteIdentifier(request.GetIndexName()); err != nil {
+		return "", nil, err
+	} else if algorithm_lock, err = indexAlgorithmLockQueryPartBuilder(request.GetAlgorithm(), request.GetLock()); err != nil {
+		return "", nil, err
+	} else {
+		return fmt.Sprintf("DROP INDEX %s ON %s %s", index_name, table_name, algorithm_lock), nil, nil
+	}
+}
+func operationQueryBuilder(operation *pb.Operation) (query string, args []any, err error) {
+	if operation == nil {
+		return failBuildQuery("no operation data")
+	}
+	switch operation.GetType() {
+	case pb.OperationType_ALTER_DATABASE:
+		return alterDatabaseQueryBuilder(operation.GetAlterDatabase())
+	case pb.OperationType_ALTER_TABLE:
+		return alterTableQueryBuilder(operation.GetAlterTable())
+	case pb.OperationType_CREATE_DATABASE:
+		return createDatabaseQueryBuilder(operation.GetCreateDatabase())
+	case pb.OperationType_CREATE_TABLE:
+		return createTableQueryBuilder(operation.GetCreateTable())
+	case pb.OperationType_DROP_DATABASE:
+		return dropDatabaseQueryBuilder(operation.GetDropDatabase())
+	case pb.OperationType_DROP_TABLE:
+		return dropTableQueryBuilder(operation.GetDropTable())
+	case pb.OperationType_RENAME_TABLE:
+		return renameTableQueryBuilder(operation.GetRenameTable())
+	case pb.OperationType_TRUNCATE_TABLE:
+		return truncateTableQueryBuilder(operation.GetTruncateTable())
+	case pb.OperationType_DELETE:
+		return deleteQueryBuilder(operation.GetDelete())
+	case pb.OperationType_UPDATE:
+		return updateQueryBuilder(operation.GetUpdate())
+	case pb.OperationType_INSERT:
+		return insertQueryBuilder(operation.GetInsert())
+	case pb.OperationType_CREATE_TRIGGER:
+		return createTriggerQueryBuilder(operation.GetCreateTrigger())
+	case pb.OperationType_DROP_TRIGGER:
+		return dropTriggerQueryBuilder(operation.GetDropTrigger())
+	case pb.OperationType_CREATE_VIEW:
+		return createViewQueryBuilder(operation.GetCreateView())
+	case pb.OperationType_ALTER_VIEW:
+		return alterViewQueryBuilder(operation.GetAlterView())
+	case pb.OperationType_DROP_VIEW:
+		return dropViewQueryBuilder(operation.GetDropView())
+	case pb.OperationType_CREATE_PROCEDURE:
+		return createProcedureQueryBuilder(operation.GetCreateProcedure())
+	case pb.OperationType_DROP_PROCEDURE:
+		return dropProcedureQueryBuilder(operation.GetDropProcedure())
+	case pb.OperationType_CALL_PROCEDURE:
+		return callProcedureQueryBuilder(operation.GetCallProcedure())
+	case pb.OperationType_SET:
+		return setQueryBuilder(operation.GetSet())
+	case pb.OperationType_CREATE_INDEX:
+		return createIndexQueryBuilder(operation.GetCreateIndex())
+	case pb.OperationType_DROP_INDEX:
+		return dropIndexQueryBuilder(operation.GetDropIndex())
+	case pb.OperationType_SELECT:
+		return selectQueryBuilder(operation.GetSelect())
+	case pb.OperationType_JOIN:
+		return joinQueryBuilder(operation.GetJoin())
+	case pb.OperationType_SHOW_DATABASES:
+		return showDatabasesQueryBuilder(operation.GetShowDatabases())
+	case pb.OperationType_SHOW_TABLES:
+		return showTablesQueryBuilder(operation.GetShowTables())
+	case pb.OperationType_SHOW_TABLE_STRUCT:
+		return showTableStructQueryBuilder(operation.GetShowTableStruct())
+	default:
+		return failBuildQuery("unknown operation type passed")
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func TestSelectQueryBuilderOrderByLimit(t *testing.T) {
+	tests := []struct {
+		select_data *pb.SelectData
+		query       string
+		args        []any
+	}{
+		{
+			&pb.SelectData{TableName: "users", ColumnNames: []string{"id", "name"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"name", "id"}, OrderByDescending: true}, Limit: 10},
+			"SELECT `id`, `name` FROM `users` ORDER BY `name` DESC, `id` DESC LIMIT 10",
+			nil,
+		},
+		{
+			&pb.SelectData{
+				TableName:      "db.users",
+				ColumnNames:    []string{"group"},
+				WhereCondition: "age > ?",
+				WhereParams:    []*pb.Value{{Type: pb.ValueType_VALUE_INT, IntValue: 18}},
+				GroupByExpr:    "`group`",
+				OrderBy:        &pb.OrderBy{Expr: "COUNT(*)"},
+				Limit:          3,
+			},
+			"SELECT `group` FROM `db`.`users` WHERE age > ? GROUP BY `group` ORDER BY COUNT(*) LIMIT 3",
+			[]any{int64(18)},
+		},
+	}
+	for _, test := range tests {
+		query, args, err := buildQuery(&pb.SelectRequest{SelectData: test.select_data}, selectQueryBuilder)
+		if err != nil {
+			t.Errorf("selectQueryBuilder: %s", err)
+		} else if query != test.query || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("selectQueryBuilder = %q, %#v, want %q, %#v", query, args, test.query, test.args)
+		} else if strings.Contains(query, "JSON_ARRAYAGG") {
+			t.Errorf("selectQueryBuilder = %q, rows mustn't be aggregated", query)
+		}
+	}
+}
+
+func TestJoinQueryBuilderOrderByLimit(t *testing.T) {
+	request := &pb.JoinRequest{
+		ColumnNames:     []string{"u.id", "o.total"},
+		FirstTableName:  "users",
+		FirstTableAlias: "u",
+		JoinClauses: []*pb.JoinClause{{
+			TableName:  "orders",
+			TableAlias: "o",
+			Join: &pb.Join{
+				JoinType:          pb.JoinType_LEFT,
+				JoinSpecification: &pb.JoinSpecification{Type: pb.JoinSpecificationType_ON, SearchCondition: "o.user_id = u.id"},
+			},
+		}},
+		WhereCondition: "o.total > ?",
+		WhereParams:    []*pb.Value{{Type: pb.ValueType_VALUE_DOUBLE, DoubleValue: 9.5}},
+		OrderBy:        &pb.OrderBy{ColumnNames: []string{"o.total"}, OrderByDescending: true},
+		Limit:          5,
+	}
+	want := "SELECT `u`.`id`, `o`.`total` FROM `users` AS `u` LEFT OUTER JOIN `orders` AS `o` ON o.user_id = u.id WHERE o.total > ? ORDER BY `o`.`total` DESC LIMIT 5"
+	if query, args, err := buildQuery(request, joinQueryBuilder); err != nil {
+		t.Errorf("joinQueryBuilder: %s", err)
+	} else if query != want || !reflect.DeepEqual(args, []any{9.5}) {
+		t.Errorf("joinQueryBuilder = %q, %#v, want %q", query, args, want)
+	}
+}
+
+func TestJoinQueryBuilderGroupBy(t *testing.T) {
+	request := &pb.JoinRequest{
+		SelectItems: []*pb.SelectItem{
+			{Type: pb.SelectItemType_COLUMN, ColumnName: "u.id"},
+			{Type: pb.SelectItemType_EXPR, Expr: "SUM(o.total)", Alias: "spent"},
+		},
+		FirstTableName:  "users",
+		FirstTableAlias: "u",
+		JoinClauses: []*pb.JoinClause{{
+			TableName:  "orders",
+			TableAlias: "o",
+			Join: &pb.Join{
+				JoinType:          pb.JoinType_INNER,
+				JoinSpecification: &pb.JoinSpecification{Type: pb.JoinSpecificationType_ON, SearchCondition: "o.user_id = u.id"},
+			},
+		}},
+		GroupByExpr:     "u.id",
+		HavingCondition: "SUM(o.total) > ?",
+		HavingParams:    []*pb.Value{{Type: pb.ValueType_VALUE_INT, IntValue: 100}},
+		OrderBy:         &pb.OrderBy{ColumnNames: []string{"spent"}, OrderByDescending: true},
+	}
+	want := "SELECT `u`.`id`, SUM(o.total) AS `spent` FROM `users` AS `u` INNER JOIN `orders` AS `o` ON o.user_id = u.id GROUP BY u.id HAVING SUM(o.total) > ? ORDER BY `spent` DESC"
+	if query, args, err := buildQuery(request, joinQueryBuilder); err != nil {
+		t.Errorf("joinQueryBuilder: %s", err)
+	} else if query != want || !reflect.DeepEqual(args, []any{int64(100)}) {
+		t.Errorf("joinQueryBuilder = %q, %#v, want %q", query, args, want)
+	}
+
+	request.ColumnNames = []string{"u.id"}
+	if _, _, err := buildQuery(request, joinQueryBuilder); err == nil || !strings.Contains(err.Error(), "select_items: mutually exclusive with column_names") {
+		t.Errorf("joinQueryBuilder with col names and select items = %v", err)
+	}
+}
+
+func TestJoinQueryBuilderFull(t *testing.T) {
+	request := &pb.JoinRequest{
+		ColumnNames:     []string{"u.id", "o.total"},
+		FirstTableName:  "users",
+		FirstTableAlias: "u",
+		JoinClauses: []*pb.JoinClause{{
+			TableName:  "orders",
+			TableAlias: "o",
+			Join: &pb.Join{
+				JoinType: pb.JoinType_FULL,
+				JoinSpecification: &pb.JoinSpecification{Type: pb.JoinSpecificationType_ON, SearchExpr: &pb.Expression{
+					Type: pb.ExpressionType_AND,
+					Operands: []*pb.Expression{
+						{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_EQ, Operands: []*pb.Expression{
+							{Type: pb.ExpressionType_COLUMN, ColumnName: "o.user_id"},
+							{Type: pb.ExpressionType_COLUMN, ColumnName: "u.id"},
+						}},
+						{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_GT, Operands: []*pb.Expression{
+							{Type: pb.ExpressionType_COLUMN, ColumnName: "o.total"},
+							{Type: pb.ExpressionType_LITERAL, Value: &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: 10}},
+						}},
+					},
+				}},
+			},
+		}},
+		WhereCondition: "u.name <> ?",
+		WhereParams:    []*pb.Value{{Type: pb.ValueType_VALUE_STRING, StringValue: "root"}},
+		OrderBy:        &pb.OrderBy{ColumnNames: []string{"total"}},
+	}
+	on := "((`o`.`user_id` = `u`.`id`) AND (`o`.`total` > ?))"
+	want := "(SELECT `u`.`id`, `o`.`total` FROM `users` AS `u` LEFT OUTER JOIN `orders` AS `o` ON " + on + " WHERE u.name <> ?)" +
+		" UNION ALL " +
+		"(SELECT `u`.`id`, `o`.`total` FROM `users` AS `u` RIGHT OUTER JOIN `orders` AS `o` ON " + on +
+		" WHERE NOT EXISTS (SELECT 1 FROM `users` AS `u` WHERE " + on + ") AND (u.name <> ?))" +
+		" ORDER BY `total`"
+	// left on, left where, right on, anti join on, right where
+	want_args := []any{int64(10), "root", int64(10), int64(10), "root"}
+	if query, args, err := buildQuery(request, joinQueryBuilder); err != nil {
+		t.Errorf("joinQueryBuilder: %s", err)
+	} else if query != want || !reflect.DeepEqual(args, want_args) {
+		t.Errorf("joinQueryBuilder = %q, %#v, want %q, %#v", query, args, want, want_args)
+	}
+
+	request.OrderBy = &pb.OrderBy{ColumnNames: []string{"o.total"}}
+	if _, _, err := buildQuery(request, joinQueryBuilder); err == nil || !strings.Contains(err.Error(), "order_by.column_names[0]: full join is ordered by result col names") {
+		t.Errorf("joinQueryBuilder of full join ordered by qualified name = %v", err)
+	}
+}
+
+func TestCreateViewQueryBuilderCheckOption(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"id"}}
+	compound_select := &pb.CompoundSelect{Operands: []*pb.CompoundSelectOperand{
+		{SelectData: select_data},
+		{SetOperation: pb.SetOperationType_UNION, SelectData: &pb.SelectData{TableName: "admins", ColumnNames: []string{"id"}}},
+	}}
+	for _, tc := range []struct {
+		request      *pb.CreateViewRequest
+		check_option string
+	}{
+		{&pb.CreateViewRequest{ViewName: "v", SelectData: select_data}, "WITH CASCADED CHECK OPTION"},
+		{&pb.CreateViewRequest{ViewName: "v", SelectData: select_data, WithCheckOption: pb.ViewWithCheckOptionType_LOCAL}, "WITH LOCAL CHECK OPTION"},
+		{&pb.CreateViewRequest{ViewName: "v", SelectData: select_data, WithCheckOption: pb.ViewWithCheckOptionType_CHECK_OPTION_NONE}, ""},
+		{&pb.CreateViewRequest{ViewName: "v", CompoundSelect: compound_select}, ""},
+		{&pb.CreateViewRequest{ViewName: "v", SelectData: select_data, Algorithm: pb.ViewAlgorithmType_TEMPTABLE}, ""},
+		{&pb.CreateViewRequest{ViewName: "v", SelectData: &pb.SelectData{TableName: "users", ColumnNames: []string{"name"}, GroupByExpr: "name"}}, ""},
+	} {
+		query, _, err := buildQuery(tc.request, createViewQueryBuilder)
+		if err != nil {
+			t.Errorf("createViewQueryBuilder: %s", err)
+		} else if tc.check_option != "" && !strings.HasSuffix(query, " "+tc.check_option) {
+			t.Errorf("createViewQueryBuilder = %q, want %s", query, tc.check_option)
+		} else if tc.check_option == "" && strings.Contains(query, "CHECK OPTION") {
+			t.Errorf("createViewQueryBuilder = %q, want no check option", query)
+		}
+	}
+
+	query, _, err := buildQuery(&pb.CreateViewRequest{ViewName: "v", CompoundSelect: compound_select}, createViewQueryBuilder)
+	if want := "CREATE  ALGORITHM = UNDEFINED VIEW `v`  AS (SELECT `id` FROM `users`) UNION (SELECT `id` FROM `admins`) "; err != nil || query != want {
+		t.Errorf("createViewQueryBuilder = %q, %v, want %q", query, err, want)
+	}
+}
+
+func TestIndexQueryBuilders(t *testing.T) {
+	create := &pb.CreateIndexRequest{
+		TableName: "shop.users",
+		Index:     &pb.Index{IndexName: "email_idx", Type: pb.IndexType_UNIQUE, KeyParts: []*pb.IndexKeyPart{{ColumnName: "email"}}},
+		Algorithm: pb.IndexAlgorithm_INPLACE,
+		Lock:      pb.IndexLock_NONE,
+	}
+	if query, _, err := buildQuery(create, createIndexQueryBuilder); err != nil || query != "CREATE UNIQUE INDEX `email_idx` ON `shop`.`users` (`email`)  ALGORITHM = INPLACE LOCK = NONE" {
+		t.Errorf("createIndexQueryBuilder = %q, %v", query, err)
+	}
+	drop := &pb.DropIndexRequest{TableName: "users", IndexName: "email_idx", Lock: pb.IndexLock_SHARED}
+	if query, _, err := buildQuery(drop, dropIndexQueryBuilder); err != nil || query != "DROP INDEX `email_idx` ON `users` LOCK = SHARED" {
+		t.Errorf("dropIndexQueryBuilder = %q, %v", query, err)
+	}
+}
@@ -7,8 +7,12 @@ import (
 	pb "greateapot.re/dblabs-api"
 )
 
+func buildQueryPartError(format string, a ...any) error {
+	return fmt.Errorf("error while building query part: %s", fmt.Sprintf(format, a...))
+}
+
 func failBuildQueryPart(format string, a ...any) (query_part string, err error) {
-	return "", fmt.Errorf("error while building query part: %s", fmt.Sprintf(format, a...))
+	return "", buildQueryPartError(format, a...)
 }
 
 func triggerOrderQueryPartBuilder(trigger_order *pb.TriggerOrder) (query_part string, err error) {
@@ -16,8 +20,10 @@ func triggerOrderQueryPartBuilder(trigger_order *pb.TriggerOrder) (query_part st
 		return failBuildQueryPart("no trigger order data")
 	} else if trigger_order.GetOtherTriggerName() == "" {
 		return failBuildQueryPart("no trigger order other trigger name")
+	} else if other_trigger_name, err := quoteIdentifier(trigger_order.GetOtherTriggerName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("%s %s", trigger_order.GetType().String(), trigger_order.GetOtherTriggerName()), nil
+		return fmt.Sprintf("%s %s", trigger_order.GetType().String(), other_trigger_name), nil
 	}
 }
 func joinColumnListQueryPartBuilder(join_column_list *pb.JoinColumnList) (query_part string, err error) {
@@ -26,24 +32,27 @@ func joinColumnListQueryPartBuilder(join_column_list *pb.JoinColumnList) (query_
 	} else if len(join_column_list.GetColumnNames()) == 0 {
 		return failBuildQueryPart("join col list is empty")
 	} else {
-		return strings.Join(join_column_list.GetColumnNames(), ", "), nil
+		return quoteIdentifierList(join_column_list.GetColumnNames(), quoteIdentifier)
 	}
 }
-func joinSpecificationQueryPartBuilder(join_specification *pb.JoinSpecification) (query_part string, err error) {
+func joinSpecificationQueryPartBuilder(join_specification *pb.JoinSpecification) (query_part string, args []any, err error) {
 	if join_specification == nil {
-		return failBuildQueryPart("no join spec data")
+		return "", nil, buildQueryPartError("no join spec data")
 	} else {
 		switch join_specification.GetType() {
 		case pb.JoinSpecificationType_ON:
-			if join_specification.GetSearchCondition() == "" {
-				return failBuildQueryPart("no search condition")
+			var search_condition string
+			if join_specification.GetSearchCondition() == "" && join_specification.GetSearchExpr() == nil {
+				return "", nil, buildQueryPartError("no search condition")
+			} else if search_condition, args, err = conditionQueryPartBuilder(join_specification.GetSearchCondition(), nil, join_specification.GetSearchExpr()); err != nil {
+				return "", nil, err
 			} else {
-				query_part = "ON " + join_specification.GetSearchCondition()
+				query_part = "ON " + search_condition
 			}
 		case pb.JoinSpecificationType_USING:
 			var join_column_list string
 			if join_column_list, err = joinColumnListQueryPartBuilder(join_specification.GetJoinColumnList()); err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query_part += fmt.Sprintf("USING (%s)", join_column_list)
 			}
@@ -51,29 +60,139 @@ func joinSpecificationQueryPartBuilder(join_specification *pb.JoinSpecification)
 		return
 	}
 }
-func rowConstructorListQueryPartBuilder(row_constructor_list *pb.RowConstructorList) (query_part string, err error) {
+func joinClauseQueryPartBuilder(join_clause *pb.JoinClause) (query_part string, args []any, err error) {
+	var table_name string
+	if join_clause == nil {
+		return "", nil, buildQueryPartError("no join clause data")
+	} else if join_clause.GetTableName() == "" {
+		return "", nil, buildQueryPartError("no join clause table name")
+	} else if join_clause.GetJoin() == nil {
+		return "", nil, buildQueryPartError("no join data")
+	} else if table_name, err = quoteSchemaObjectName(join_clause.GetTableName()); err != nil {
+		return "", nil, err
+	}
+	is_join_specification_required := false
+	is_join_specification_allowed := true
+	switch join_clause.GetJoin().GetJoinType() {
+	case pb.JoinType_INNER, pb.JoinType_CROSS:
+		query_part = fmt.Sprintf("%s JOIN %s", join_clause.GetJoin().GetJoinType().String(), table_name)
+	case pb.JoinType_LEFT, pb.JoinType_RIGHT:
+		is_join_specification_required = true
+		query_part = fmt.Sprintf("%s OUTER JOIN %s", join_clause.GetJoin().GetJoinType().String(), table_name)
+	case pb.JoinType_NATURAL:
+		is_join_specification_allowed = false
+		query_part = "NATURAL JOIN " + table_name
+	case pb.JoinType_NATURAL_LEFT:
+		is_join_specification_allowed = false
+		query_part = "NATURAL LEFT OUTER JOIN " + table_name
+	case pb.JoinType_NATURAL_RIGHT:
+		is_join_specification_allowed = false
+		query_part = "NATURAL RIGHT OUTER JOIN " + table_name
+	case pb.JoinType_STRAIGHT:
+		// mysql allows only ON with STRAIGHT_JOIN
+		if join_clause.GetJoin().GetJoinSpecification().GetType() == pb.JoinSpecificationType_USING {
+			return "", nil, buildQueryPartError("straight join doesn't support using spec")
+		}
+		query_part = "STRAIGHT_JOIN " + table_name
+	case pb.JoinType_FULL:
+		return "", nil, buildQueryPartError("full join must be the only join clause")
+	default:
+		return "", nil, buildQueryPartError("unknown join type")
+	}
+	if join_clause.GetTableAlias() != "" {
+		var table_alias string
+		if table_alias, err = quoteIdentifier(join_clause.GetTableAlias()); err != nil {
+			return "", nil, err
+		} else {
+			query_part += " AS " + table_alias
+		}
+	}
+	if is_join_specification_required && join_clause.GetJoin().GetJoinSpecification() == nil {
+		return "", nil, buildQueryPartError("no join spec for this join type")
+	} else if !is_join_specification_allowed && join_clause.GetJoin().GetJoinSpecification() != nil {
+		return "", nil, buildQueryPartError("join spec isn't allowed for natural join")
+	} else if join_clause.GetJoin().GetJoinSpecification() != nil {
+		var join_specification string
+		if join_specification, args, err = joinSpecificationQueryPartBuilder(join_clause.GetJoin().GetJoinSpecification()); err != nil {
+			return "", nil, err
+		} else {
+			query_part += " " + join_specification
+		}
+	}
+	return
+}
+
+// fullJoinQueryPartBuilder emulates FULL OUTER JOIN, which mysql lacks, as LEFT JOIN UNION ALL RIGHT JOIN
+// of rows having no match on the left. Anti join re-reads first table in NOT EXISTS,
+// which shadows the outer one, so search condition keeps referring to the same names.
+// join_args are args of search condition, each of left, right and anti join takes them.
+func fullJoinQueryPartBuilder(first_table string, join_clause *pb.JoinClause) (left_join string, right_join string, anti_join string, join_args []any, err error) {
+	join_specification := join_clause.GetJoin().GetJoinSpecification()
+	if join_specification == nil || join_specification.GetType() != pb.JoinSpecificationType_ON {
+		err = buildQueryPartError("full join requires on spec")
+		return
+	} else if join_specification.GetSearchCondition() == "" && join_specification.GetSearchExpr() == nil {
+		err = buildQueryPartError("no search condition")
+		return
+	}
+	var search_condition string
+	if left_join, join_args, err = joinClauseQueryPartBuilder(&pb.JoinClause{
+		TableName:  join_clause.GetTableName(),
+		TableAlias: join_clause.GetTableAlias(),
+		Join:       &pb.Join{JoinType: pb.JoinType_LEFT, JoinSpecification: join_specification},
+	}); err != nil {
+		return
+	} else if right_join, _, err = joinClauseQueryPartBuilder(&pb.JoinClause{
+		TableName:  join_clause.GetTableName(),
+		TableAlias: join_clause.GetTableAlias(),
+		Join:       &pb.Join{JoinType: pb.JoinType_RIGHT, JoinSpecification: join_specification},
+	}); err != nil {
+		return
+	} else if search_condition, _, err = conditionQueryPartBuilder(join_specification.GetSearchCondition(), nil, join_specification.GetSearchExpr()); err != nil {
+		return
+	}
+	anti_join = fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s)", first_table, search_condition)
+	return
+}
+func rowConstructorListQueryPartBuilder(row_constructor_list *pb.RowConstructorList) (query_part string, args []any, err error) {
 	if row_constructor_list == nil {
-		return failBuildQuery("no row constructor list data")
+		return "", nil, buildQueryPartError("no row constructor list data")
 	} else if len(row_constructor_list.GetValueList()) == 0 {
-		return failBuildQueryPart("row constructor list value list is empty")
+		return "", nil, buildQueryPartError("row constructor list value list is empty")
 	} else {
 		value_lists := []string{}
 
 		for _, v := range row_constructor_list.GetValueList() {
 			var value_list string
-			if value_list, err = valueListQueryPartBuilder(v); err != nil {
-				return "", err
+			var value_list_args []any
+			if value_list, value_list_args, err = valueListQueryPartBuilder(v); err != nil {
+				return "", nil, err
 			} else {
 				value_lists = append(value_lists, fmt.Sprintf("ROW(%s)", value_list))
+				args = append(args, value_list_args...)
 			}
 		}
 
-		return strings.Join(value_lists, ", "), nil
+		return strings.Join(value_lists, ", "), args, nil
 	}
 }
 func orderByQueryPartBuilder(order_by *pb.OrderBy) (query_part string, err error) {
 	if order_by == nil {
 		return failBuildQueryPart("no order by data")
+	} else if len(order_by.GetColumnNames()) > 0 {
+		// structured keys (used by keyset pagination), direction applies to every key
+		quoted_names := make([]string, 0, len(order_by.GetColumnNames()))
+		for _, column_name := range order_by.GetColumnNames() {
+			var quoted_name string
+			if quoted_name, err = quoteColumnName(column_name); err != nil {
+				return "", err
+			} else if order_by.GetOrderByDescending() {
+				quoted_names = append(quoted_names, quoted_name+" DESC")
+			} else {
+				quoted_names = append(quoted_names, quoted_name)
+			}
+		}
+		return "ORDER BY " + strings.Join(quoted_names, ", "), nil
 	} else if order_by.GetExpr() == "" {
 		return failBuildQueryPart("no order by expr")
 	} else {
@@ -84,66 +203,81 @@ func orderByQueryPartBuilder(order_by *pb.OrderBy) (query_part string, err error
 		return
 	}
 }
-func valueQueryPartBuilder(value *pb.Value) (query_part string, err error) {
+func valueQueryPartBuilder(value *pb.Value) (query_part string, args []any, err error) {
 	if value == nil {
-		return failBuildQueryPart("no value data")
+		return "", nil, buildQueryPartError("no value data")
 	} else {
 		switch value.GetType() {
 		case pb.ValueType_VALUE_DEFAULT:
-			return "DEFAULT", nil
-		case pb.ValueType_VALUE_EXPR:
+			return "DEFAULT", nil, nil
+		case pb.ValueType_VALUE_EXPR: // raw sql, opt-in
 			if value.GetExpr() == "" {
-				return failBuildQueryPart("no value expr")
+				return "", nil, buildQueryPartError("no value expr")
+			} else if countPlaceholders(value.GetExpr()) != 0 {
+				return "", nil, buildQueryPartError("value expr can't contain placeholders")
 			} else {
-				return value.GetExpr(), nil
+				return value.GetExpr(), nil, nil
 			}
+		case pb.ValueType_VALUE_NULL:
+			return "NULL", nil, nil
 		default:
-			return failBuildQueryPart("unknown assignment type")
+			var arg any
+			if arg, err = valueParam(value); err != nil {
+				return "", nil, buildQueryPartError("unknown value type (%s)", err.Error())
+			} else {
+				return "?", []any{arg}, nil
+			}
 		}
 	}
 }
-func valueListQueryPartBuilder(value_list *pb.ValueList) (query_part string, err error) {
+func valueListQueryPartBuilder(value_list *pb.ValueList) (query_part string, args []any, err error) {
 	if value_list == nil {
-		return failBuildQueryPart("no value list data")
+		return "", nil, buildQueryPartError("no value list data")
 	} else if len(value_list.GetValues()) == 0 {
-		return failBuildQueryPart("value list is empty")
+		return "", nil, buildQueryPartError("value list is empty")
 	} else {
 		values := []string{}
 
 		for _, value := range value_list.GetValues() {
 			var v string
-			if v, err = valueQueryPartBuilder(value); err != nil {
-				return "", err
+			var v_args []any
+			if v, v_args, err = valueQueryPartBuilder(value); err != nil {
+				return "", nil, err
 			} else {
 				values = append(values, v)
+				args = append(args, v_args...)
 			}
 		}
 
-		return strings.Join(values, ", "), nil
+		return strings.Join(values, ", "), args, nil
 	}
 }
-func assignmentListQueryPartBuilder(assignment_list *pb.AssignmentList) (query_part string, err error) {
+func assignmentListQueryPartBuilder(assignment_list *pb.AssignmentList) (query_part string, args []any, err error) {
 	if assignment_list == nil {
-		return failBuildQueryPart("no assignment list data")
+		return "", nil, buildQueryPartError("no assignment list data")
 	} else if len(assignment_list.GetAssignments()) == 0 {
-		return failBuildQueryPart("assignment list is empty")
+		return "", nil, buildQueryPartError("assignment list is empty")
 	} else {
 		assignments := []string{}
 
 		for _, assignment := range assignment_list.GetAssignments() {
-			var value string
+			var column_name, value string
+			var value_args []any
 			if assignment.GetColumnName() == "" {
-				return failBuildQueryPart("no assignment col name")
+				return "", nil, buildQueryPartError("no assignment col name")
+			} else if column_name, err = quoteColumnName(assignment.GetColumnName()); err != nil {
+				return "", nil, err
 			} else if assignment.GetValue() == nil {
-				return failBuildQueryPart("no assignment value")
-			} else if value, err = valueQueryPartBuilder(assignment.GetValue()); err != nil {
-				return "", err
+				return "", nil, buildQueryPartError("no assignment value")
+			} else if value, value_args, err = valueQueryPartBuilder(assignment.GetValue()); err != nil {
+				return "", nil, err
 			} else {
-				assignments = append(assignments, fmt.Sprintf("%s = %s", assignment.GetColumnName(), value))
+				assignments = append(assignments, fmt.Sprintf("%s = %s", column_name, value))
+				args = append(args, value_args...)
 			}
 		}
 
-		return strings.Join(assignments, ", "), nil
+		return strings.Join(assignments, ", "), args, nil
 	}
 }
 func dropKeyQueryPartBuilder(drop_key *pb.DropKey) (query_part string, err error) {
@@ -151,8 +285,10 @@ func dropKeyQueryPartBuilder(drop_key *pb.DropKey) (query_part string, err error
 		return failBuildQueryPart("no drop key data")
 	} else if drop_key.GetKeyName() == "" {
 		return failBuildQueryPart("no key name")
+	} else if key_name, err := quoteIdentifier(drop_key.GetKeyName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("DROP KEY %s", drop_key.GetKeyName()), nil
+		return fmt.Sprintf("DROP KEY %s", key_name), nil
 	}
 }
 func dropColumnQueryPartBuilder(drop_column *pb.DropColumn) (query_part string, err error) {
@@ -160,8 +296,10 @@ func dropColumnQueryPartBuilder(drop_column *pb.DropColumn) (query_part string,
 		return failBuildQueryPart("no drop col data")
 	} else if drop_column.GetColumnName() == "" {
 		return failBuildQueryPart("no col name")
+	} else if column_name, err := quoteIdentifier(drop_column.GetColumnName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("DROP COLUMN %s", drop_column.GetColumnName()), nil
+		return fmt.Sprintf("DROP COLUMN %s", column_name), nil
 	}
 }
 func dropPrimaryKeyQueryPartBuilder(drop_primary_key *pb.DropPrimaryKey) (query_part string, err error) {
@@ -176,8 +314,10 @@ func dropForeignKeyQueryPartBuilder(drop_foreign_key *pb.DropForeignKey) (query_
 		return failBuildQueryPart("no drop fk data")
 	} else if drop_foreign_key.GetForeignKeySymbol() == "" {
 		return failBuildQueryPart("no fk symbol")
+	} else if foreign_key_symbol, err := quoteIdentifier(drop_foreign_key.GetForeignKeySymbol()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("DROP FOREIGN KEY %s", drop_foreign_key.GetForeignKeySymbol()), nil
+		return fmt.Sprintf("DROP FOREIGN KEY %s", foreign_key_symbol), nil
 	}
 }
 func modifyQueryPartBuilder(modify *pb.Modify) (query_part string, err error) {
@@ -196,8 +336,10 @@ func orderQueryPartBuilder(order *pb.Order) (query_part string, err error) {
 		return failBuildQueryPart("no order data")
 	} else if len(order.GetColumnNames()) == 0 {
 		return failBuildQueryPart("col names is empty")
+	} else if column_names, err := quoteIdentifierList(order.GetColumnNames(), quoteIdentifier); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("ORDER BY %s", strings.Join(order.GetColumnNames(), ", ")), nil
+		return fmt.Sprintf("ORDER BY %s", column_names), nil
 	}
 }
 func renameColumnQueryPartBuilder(rename_column *pb.RenameColumn) (query_part string, err error) {
@@ -207,8 +349,12 @@ func renameColumnQueryPartBuilder(rename_column *pb.RenameColumn) (query_part st
 		return failBuildQueryPart("no old col name")
 	} else if rename_column.GetNewColumnName() == "" {
 		return failBuildQueryPart("no new col name")
+	} else if old_column_name, err := quoteIdentifier(rename_column.GetOldColumnName()); err != nil {
+		return "", err
+	} else if new_column_name, err := quoteIdentifier(rename_column.GetNewColumnName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("RENAME COLUMN %s TO %s", rename_column.GetOldColumnName(), rename_column.GetNewColumnName()), nil
+		return fmt.Sprintf("RENAME COLUMN %s TO %s", old_column_name, new_column_name), nil
 	}
 }
 func renameQueryPartBuilder(rename *pb.Rename) (query_part string, err error) {
@@ -216,8 +362,10 @@ func renameQueryPartBuilder(rename *pb.Rename) (query_part string, err error) {
 		return failBuildQueryPart("no rename data")
 	} else if rename.GetNewTableName() == "" {
 		return failBuildQueryPart("no new table name")
+	} else if new_table_name, err := quoteSchemaObjectName(rename.GetNewTableName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("RENAME TO %s", rename.GetNewTableName()), nil
+		return fmt.Sprintf("RENAME TO %s", new_table_name), nil
 	}
 }
 func changeQueryPartBuilder(change *pb.Change) (query_part string, err error) {
@@ -225,12 +373,14 @@ func changeQueryPartBuilder(change *pb.Change) (query_part string, err error) {
 		return failBuildQueryPart("no change data")
 	} else if change.GetOldColumnName() == "" {
 		return failBuildQueryPart("no change old col name")
+	} else if old_column_name, err := quoteIdentifier(change.GetOldColumnName()); err != nil {
+		return "", err
 	} else if column, err := columnQueryPartBuilder(change.GetNewColumn()); err != nil {
 		return "", err
 	} else if insert, err := insertQueryPartBuilder(change.GetInsert()); err != nil {
 		return "", err
 	} else {
-		return strings.TrimSpace(fmt.Sprintf("CHANGE %s %s %s", change.GetOldColumnName(), column, insert)), nil
+		return strings.TrimSpace(fmt.Sprintf("CHANGE %s %s %s", old_column_name, column, insert)), nil
 	}
 }
 func addColumnQueryPartBuilder(add_column *pb.AddColumn) (query_part string, err error) {
@@ -279,6 +429,8 @@ func insertQueryPartBuilder(insert *pb.InsertColumn) (query_part string, err err
 		case pb.InsertColumnType_AFTER:
 			if after_column_name := insert.GetAfterColumnName(); after_column_name == "" {
 				return failBuildQueryPart("no col name for insert after option")
+			} else if after_column_name, err = quoteIdentifier(after_column_name); err != nil {
+				return "", err
 			} else {
 				query_part = fmt.Sprintf("AFTER %s", after_column_name)
 			}
@@ -296,6 +448,15 @@ func readOnlyQueryPartBuilder(ro pb.ReadOnly) string {
 		return "READ ONLY = DEFAULT"
 	}
 }
+func constraintSymbolQueryPartBuilder(symbol string) (query_part string, err error) {
+	if symbol == "" {
+		return "", nil // symbol is optional
+	} else if symbol, err = quoteIdentifier(symbol); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("CONSTRAINT %s ", symbol), nil
+	}
+}
 func foreignKeyQueryPartBuilder(fk *pb.ForeignKey) (query_part string, err error) {
 	if fk == nil {
 		return failBuildQueryPart("no fk data")
@@ -308,13 +469,62 @@ func foreignKeyQueryPartBuilder(fk *pb.ForeignKey) (query_part string, err error
 	} else if fk.GetParentTableName() == "" {
 		return failBuildQueryPart("no fk parent table name")
 	}
-	return fmt.Sprintf(
-		"CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s)",
-		fk.GetConstraintSymbol(),
-		strings.Join(fk.GetColumnNames(), ", "),
-		fk.GetParentTableName(),
-		strings.Join(fk.GetParentKeyParts(), ", "),
-	), nil
+	var constraint, column_names, parent_table_name, parent_key_parts string
+	if constraint, err = constraintSymbolQueryPartBuilder(fk.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else if column_names, err = quoteIdentifierList(fk.GetColumnNames(), quoteIdentifier); err != nil {
+		return "", err
+	} else if parent_table_name, err = quoteSchemaObjectName(fk.GetParentTableName()); err != nil {
+		return "", err
+	} else if parent_key_parts, err = quoteIdentifierList(fk.GetParentKeyParts(), quoteIdentifier); err != nil {
+		return "", err
+	}
+	query_part = constraint + "FOREIGN KEY "
+	if fk.GetIndexName() != "" {
+		var index_name string
+		if index_name, err = quoteIdentifier(fk.GetIndexName()); err != nil {
+			return "", err
+		} else {
+			query_part += index_name + " "
+		}
+	}
+	query_part += fmt.Sprintf("(%s) REFERENCES %s(%s)", column_names, parent_table_name, parent_key_parts)
+	switch fk.GetMatch() {
+	case pb.ForeignKeyMatch_MATCH_DEFAULT:
+	case pb.ForeignKeyMatch_FULL, pb.ForeignKeyMatch_PARTIAL, pb.ForeignKeyMatch_SIMPLE:
+		query_part += " MATCH " + fk.GetMatch().String()
+	default:
+		return failBuildQueryPart("unknown fk match type")
+	}
+	if on_delete, err := referenceOptionQueryPartBuilder(fk.GetOnDelete()); err != nil {
+		return "", err
+	} else if on_delete != "" {
+		query_part += " ON DELETE " + on_delete
+	}
+	if on_update, err := referenceOptionQueryPartBuilder(fk.GetOnUpdate()); err != nil {
+		return "", err
+	} else if on_update != "" {
+		query_part += " ON UPDATE " + on_update
+	}
+	return
+}
+func referenceOptionQueryPartBuilder(reference_option pb.ReferenceOption) (query_part string, err error) {
+	switch reference_option {
+	case pb.ReferenceOption_REFERENCE_DEFAULT:
+		return "", nil // server default is NO ACTION
+	case pb.ReferenceOption_RESTRICT:
+		return "RESTRICT", nil
+	case pb.ReferenceOption_CASCADE:
+		return "CASCADE", nil
+	case pb.ReferenceOption_SET_NULL:
+		return "SET NULL", nil
+	case pb.ReferenceOption_NO_ACTION:
+		return "NO ACTION", nil
+	case pb.ReferenceOption_SET_DEFAULT:
+		return "SET DEFAULT", nil // parsed, but rejected by InnoDB
+	default:
+		return failBuildQueryPart("unknown reference option")
+	}
 }
 func uniqueKeyQueryPartBuilder(uk *pb.UniqueKey) (query_part string, err error) {
 	if uk == nil {
@@ -322,10 +532,16 @@ func uniqueKeyQueryPartBuilder(uk *pb.UniqueKey) (query_part string, err error)
 	} else if len(uk.GetKeyParts()) == 0 {
 		return failBuildQueryPart("uk key parts is empty")
 	}
+	var constraint, key_parts string
+	if constraint, err = constraintSymbolQueryPartBuilder(uk.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else if key_parts, err = quoteIdentifierList(uk.GetKeyParts(), quoteIdentifier); err != nil {
+		return "", err
+	}
 	return fmt.Sprintf(
-		"CONSTRAINT %s UNIQUE KEY (%s)",
-		uk.GetConstraintSymbol(),
-		strings.Join(uk.GetKeyParts(), ", "),
+		"%sUNIQUE KEY (%s)",
+		constraint,
+		key_parts,
 	), nil
 }
 func primaryKeyQueryPartBuilder(pk *pb.PrimaryKey) (query_part string, err error) {
@@ -334,12 +550,238 @@ func primaryKeyQueryPartBuilder(pk *pb.PrimaryKey) (query_part string, err error
 	} else if len(pk.GetKeyParts()) == 0 {
 		return failBuildQueryPart("pk key parts is empty")
 	}
+	var constraint, key_parts string
+	if constraint, err = constraintSymbolQueryPartBuilder(pk.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else if key_parts, err = quoteIdentifierList(pk.GetKeyParts(), quoteIdentifier); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"%sPRIMARY KEY (%s)",
+		constraint,
+		key_parts,
+	), nil
+}
+func indexKeyPartQueryPartBuilder(key_part *pb.IndexKeyPart) (query_part string, err error) {
+	if key_part == nil {
+		return failBuildQueryPart("no index key part data")
+	} else if key_part.GetColumnName() == "" {
+		return failBuildQueryPart("no index key part col name")
+	} else if query_part, err = quoteIdentifier(key_part.GetColumnName()); err != nil {
+		return "", err
+	}
+	if key_part.GetLength() != 0 {
+		query_part += fmt.Sprintf("(%d)", key_part.GetLength())
+	}
+	if key_part.GetDescending() {
+		query_part += " DESC"
+	}
+	return
+}
+func indexKeyPartListQueryPartBuilder(key_parts []*pb.IndexKeyPart) (query_part string, err error) {
+	if len(key_parts) == 0 {
+		return failBuildQueryPart("index key parts is empty")
+	}
+	quoted_key_parts := make([]string, 0, len(key_parts))
+	for _, key_part := range key_parts {
+		var quoted_key_part string
+		if quoted_key_part, err = indexKeyPartQueryPartBuilder(key_part); err != nil {
+			return "", err
+		} else {
+			quoted_key_parts = append(quoted_key_parts, quoted_key_part)
+		}
+	}
+	return strings.Join(quoted_key_parts, ", "), nil
+}
+func indexOptionsQueryPartBuilder(index_options *pb.IndexOptions) (query_part string, err error) {
+	if index_options == nil {
+		return "", nil // options are optional
+	}
+	options := []string{}
+	if index_options.GetKeyBlockSize() != 0 {
+		options = append(options, fmt.Sprintf("KEY_BLOCK_SIZE = %d", index_options.GetKeyBlockSize()))
+	}
+	switch index_options.GetUsing() {
+	case pb.IndexUsing_USING_DEFAULT:
+	case pb.IndexUsing_BTREE, pb.IndexUsing_HASH:
+		options = append(options, "USING "+index_options.GetUsing().String())
+	default:
+		return failBuildQueryPart("unknown index using type")
+	}
+	if index_options.GetParser() != "" {
+		var parser string
+		if parser, err = quoteIdentifier(index_options.GetParser()); err != nil {
+			return "", err
+		} else {
+			options = append(options, "WITH PARSER "+parser)
+		}
+	}
+	if index_options.GetComment() != "" {
+		var comment string
+		if comment, err = stringLiteralQueryPartBuilder(index_options.GetComment()); err != nil {
+			return "", err
+		} else {
+			options = append(options, "COMMENT "+comment)
+		}
+	}
+	if index_options.GetInvisible() {
+		options = append(options, "INVISIBLE")
+	}
+	return strings.Join(options, " "), nil
+}
+func indexTypeQueryPartBuilder(index_type pb.IndexType) (query_part string, err error) {
+	switch index_type {
+	case pb.IndexType_PLAIN:
+		return "INDEX", nil
+	case pb.IndexType_UNIQUE:
+		return "UNIQUE INDEX", nil
+	case pb.IndexType_FULLTEXT:
+		return "FULLTEXT INDEX", nil
+	case pb.IndexType_SPATIAL:
+		return "SPATIAL INDEX", nil
+	default:
+		return failBuildQueryPart("unknown index type")
+	}
+}
+
+// indexQueryPartBuilder renders index definition as in ALTER TABLE ADD / CREATE TABLE, name is optional there.
+func indexQueryPartBuilder(index *pb.Index) (query_part string, err error) {
+	if index == nil {
+		return failBuildQueryPart("no index data")
+	}
+	var index_type, key_parts, index_options string
+	if index_type, err = indexTypeQueryPartBuilder(index.GetType()); err != nil {
+		return "", err
+	} else if key_parts, err = indexKeyPartListQueryPartBuilder(index.GetKeyParts()); err != nil {
+		return "", err
+	} else if index_options, err = indexOptionsQueryPartBuilder(index.GetOptions()); err != nil {
+		return "", err
+	}
+	query_part = index_type
+	if index.GetIndexName() != "" {
+		var index_name string
+		if index_name, err = quoteIdentifier(index.GetIndexName()); err != nil {
+			return "", err
+		} else {
+			query_part += " " + index_name
+		}
+	}
+	query_part += fmt.Sprintf(" (%s)", key_parts)
+	if index_options != "" {
+		query_part += " " + index_options
+	}
+	return
+}
+func indexAlgorithmLockQueryPartBuilder(algorithm pb.IndexAlgorithm, lock pb.IndexLock) (query_part string, err error) {
+	options := []string{}
+	switch algorithm {
+	case pb.IndexAlgorithm_ALGORITHM_DEFAULT:
+	case pb.IndexAlgorithm_INPLACE, pb.IndexAlgorithm_COPY:
+		options = append(options, "ALGORITHM = "+algorithm.String())
+	default:
+		return failBuildQueryPart("unknown index algorithm")
+	}
+	switch lock {
+	case pb.IndexLock_LOCK_DEFAULT:
+	case pb.IndexLock_NONE, pb.IndexLock_SHARED, pb.IndexLock_EXCLUSIVE:
+		options = append(options, "LOCK = "+lock.String())
+	default:
+		return failBuildQueryPart("unknown index lock")
+	}
+	return strings.Join(options, " "), nil
+}
+func addIndexQueryPartBuilder(add_index *pb.AddIndex) (query_part string, err error) {
+	if add_index == nil {
+		return failBuildQueryPart("no add index data")
+	} else if index, err := indexQueryPartBuilder(add_index.GetIndex()); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("ADD %s", index), nil
+	}
+}
+func dropIndexQueryPartBuilder(drop_index *pb.DropIndex) (query_part string, err error) {
+	if drop_index == nil {
+		return failBuildQueryPart("no drop index data")
+	} else if drop_index.GetIndexName() == "" {
+		return failBuildQueryPart("no index name")
+	} else if index_name, err := quoteIdentifier(drop_index.GetIndexName()); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("DROP INDEX %s", index_name), nil
+	}
+}
+func alterIndexQueryPartBuilder(alter_index *pb.AlterIndex) (query_part string, err error) {
+	if alter_index == nil {
+		return failBuildQueryPart("no alter index data")
+	} else if alter_index.GetIndexName() == "" {
+		return failBuildQueryPart("no index name")
+	} else if index_name, err := quoteIdentifier(alter_index.GetIndexName()); err != nil {
+		return "", err
+	} else if alter_index.GetInvisible() {
+		return fmt.Sprintf("ALTER INDEX %s INVISIBLE", index_name), nil
+	} else {
+		return fmt.Sprintf("ALTER INDEX %s VISIBLE", index_name), nil
+	}
+}
+func enforcedQueryPartBuilder(not_enforced bool) string {
+	if not_enforced {
+		return "NOT ENFORCED"
+	}
+	return "ENFORCED"
+}
+func checkQueryPartBuilder(check *pb.Check) (query_part string, err error) {
+	if check == nil {
+		return failBuildQueryPart("no check data")
+	} else if check.GetCondition() == "" && check.GetConditionExpr() == nil {
+		return failBuildQueryPart("no check condition")
+	}
+	var constraint, condition string
+	var condition_args []any
+	if constraint, err = constraintSymbolQueryPartBuilder(check.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else if condition, condition_args, err = conditionQueryPartBuilder(check.GetCondition(), nil, check.GetConditionExpr()); err != nil {
+		return "", err
+	} else if condition, err = inlineQueryParams(condition, condition_args); err != nil {
+		return "", err // check definition can't contain params
+	}
 	return fmt.Sprintf(
-		"CONSTRAINT %s PRIMARY KEY (%s)",
-		pk.GetConstraintSymbol(),
-		strings.Join(pk.GetKeyParts(), ", "),
+		"%sCHECK (%s) %s",
+		constraint,
+		condition,
+		enforcedQueryPartBuilder(check.GetNotEnforced()),
 	), nil
 }
+func addCheckQueryPartBuilder(add_check *pb.AddCheck) (query_part string, err error) {
+	if add_check == nil {
+		return failBuildQueryPart("no add check data")
+	} else if check, err := checkQueryPartBuilder(add_check.GetCheck()); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("ADD %s", check), nil
+	}
+}
+func dropCheckQueryPartBuilder(drop_check *pb.DropCheck) (query_part string, err error) {
+	if drop_check == nil {
+		return failBuildQueryPart("no drop check data")
+	} else if drop_check.GetConstraintSymbol() == "" {
+		return failBuildQueryPart("no check symbol")
+	} else if constraint_symbol, err := quoteIdentifier(drop_check.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("DROP CHECK %s", constraint_symbol), nil
+	}
+}
+func alterCheckQueryPartBuilder(alter_check *pb.AlterCheck) (query_part string, err error) {
+	if alter_check == nil {
+		return failBuildQueryPart("no alter check data")
+	} else if alter_check.GetConstraintSymbol() == "" {
+		return failBuildQueryPart("no check symbol")
+	} else if constraint_symbol, err := quoteIdentifier(alter_check.GetConstraintSymbol()); err != nil {
+		return "", err
+	} else {
+		return fmt.Sprintf("ALTER CHECK %s %s", constraint_symbol, enforcedQueryPartBuilder(alter_check.GetNotEnforced())), nil
+	}
+}
 func columnQueryPartBuilder(column *pb.Column) (query_part string, err error) {
 	if column == nil {
 		return failBuildQueryPart("no column data")
@@ -347,30 +789,123 @@ func columnQueryPartBuilder(column *pb.Column) (query_part string, err error) {
 		return failBuildQueryPart("no column name")
 	} else if column.GetDataType() == nil {
 		return failBuildQueryPart("no data type (col: %s)", column.GetColumnName())
+	} else if column.GetNotNull() && column.GetNull() {
+		return failBuildQueryPart("col can't be both NULL and NOT NULL (col: %s)", column.GetColumnName())
+	} else if query_part, err = quoteIdentifier(column.GetColumnName()); err != nil {
+		return "", err
 	} else {
-		query_part = column.GetColumnName()
 		data_type := ""
 		if data_type, err = dataTypeQueryPartBuilder(column.GetDataType()); err != nil {
 			return "", err
 		} else {
 			query_part += " " + data_type
 		}
+		if column.GetCollate() != "" {
+			var collate string
+			if collate, err = quoteIdentifier(column.GetCollate()); err != nil {
+				return "", err
+			} else {
+				query_part += " COLLATE " + collate
+			}
+		}
+		if column.GetGenerated() != nil {
+			var generated string
+			if column.GetDefaultValue() != nil || column.GetOnUpdateCurrentTimestamp() || column.GetDataType().GetIntAttrs().GetAutoIncrement() {
+				return failBuildQueryPart("generated col can't have default, on update or auto increment (col: %s)", column.GetColumnName())
+			} else if generated, err = generatedColumnQueryPartBuilder(column.GetGenerated()); err != nil {
+				return "", err
+			} else {
+				query_part += " " + generated
+			}
+		}
 		if column.GetNotNull() {
 			query_part += " NOT NULL"
+		} else if column.GetNull() {
+			query_part += " NULL"
 		}
 		if column.GetDefaultValue() != nil {
-			query_part += fmt.Sprintf(" DEFAULT %s", column.GetDefaultValue().GetValue())
+			var default_value string
+			if default_value, err = defaultValueQueryPartBuilder(column.GetDefaultValue()); err != nil {
+				return "", err
+			} else {
+				query_part += " DEFAULT " + default_value
+			}
+		}
+		if column.GetOnUpdateCurrentTimestamp() {
+			// fsp has to match the one of col
+			if fsp := column.GetDataType().GetTimeAttrs().GetFsp(); fsp != 0 {
+				query_part += fmt.Sprintf(" ON UPDATE CURRENT_TIMESTAMP(%d)", fsp)
+			} else {
+				query_part += " ON UPDATE CURRENT_TIMESTAMP"
+			}
+		}
+		if column.GetInvisible() {
+			query_part += " INVISIBLE"
+		}
+		if column.GetUnique() {
+			query_part += " UNIQUE"
+		}
+		if column.GetPrimaryKey() {
+			query_part += " PRIMARY KEY"
+		}
+		if column.GetComment() != "" {
+			var comment string
+			if comment, err = stringLiteralQueryPartBuilder(column.GetComment()); err != nil {
+				return "", err
+			} else {
+				query_part += " COMMENT " + comment
+			}
 		}
 		return
 	}
 }
+
+// defaultValueQueryPartBuilder renders legacy raw Value, (Expr) or inlined Literal, exactly one is expected.
+func defaultValueQueryPartBuilder(default_value *pb.DefaultValue) (query_part string, err error) {
+	set := 0
+	for _, is_set := range []bool{default_value.GetValue() != "", default_value.GetExpr() != "", default_value.GetLiteral() != nil} {
+		if is_set {
+			set++
+		}
+	}
+	if default_value == nil || set == 0 {
+		return failBuildQueryPart("no default value")
+	} else if set > 1 {
+		return failBuildQueryPart("default value, expr and literal are mutually exclusive")
+	} else if default_value.GetExpr() != "" {
+		return fmt.Sprintf("(%s)", default_value.GetExpr()), nil
+	} else if default_value.GetLiteral() != nil {
+		var literal string
+		var literal_args []any
+		if default_value.GetLiteral().GetType() == pb.ValueType_VALUE_DEFAULT {
+			return failBuildQueryPart("DEFAULT isn't allowed as default value")
+		} else if literal, literal_args, err = valueQueryPartBuilder(default_value.GetLiteral()); err != nil {
+			return "", err
+		} else {
+			return inlineQueryParams(literal, literal_args) // ddl can't contain params
+		}
+	} else {
+		return default_value.GetValue(), nil
+	}
+}
+func generatedColumnQueryPartBuilder(generated *pb.GeneratedColumn) (query_part string, err error) {
+	if generated.GetExpr() == "" {
+		return failBuildQueryPart("no generated col expr")
+	} else if generated.GetStored() {
+		return fmt.Sprintf("AS (%s) STORED", generated.GetExpr()), nil
+	} else {
+		return fmt.Sprintf("AS (%s) VIRTUAL", generated.GetExpr()), nil
+	}
+}
 func asQueryPartBuilder(as *pb.As) (query_part string, err error) {
 	if as == nil {
 		return failBuildQueryPart("no as data")
 	} else if as.GetName() == "" {
 		return failBuildQueryPart("no as name")
+	} else if as_name, err := quoteSchemaObjectName(as.GetName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("AS %s", as.GetName()), nil
+		return fmt.Sprintf("AS TABLE %s", as_name), nil
 	}
 }
 func likeQueryPartBuilder(like *pb.Like) (query_part string, err error) {
@@ -378,67 +913,542 @@ func likeQueryPartBuilder(like *pb.Like) (query_part string, err error) {
 		return failBuildQueryPart("no like data")
 	} else if like.GetName() == "" {
 		return failBuildQueryPart("no like name")
+	} else if like_name, err := quoteSchemaObjectName(like.GetName()); err != nil {
+		return "", err
 	} else {
-		return fmt.Sprintf("LIKE %s", like.GetName()), nil
+		return fmt.Sprintf("LIKE %s", like_name), nil
 	}
 }
+func tableOptionsQueryPartBuilder(table_options *pb.TableOptions) (query_part string, err error) {
+	if table_options == nil {
+		return failBuildQueryPart("no table options data")
+	}
+	options := []string{}
+	for _, option := range []struct {
+		name  string
+		value string
+	}{
+		{"ENGINE", table_options.GetEngine()},
+		{"DEFAULT CHARSET", table_options.GetCharset()},
+		{"COLLATE", table_options.GetCollate()},
+	} {
+		if option.value != "" {
+			var value string
+			if value, err = quoteIdentifier(option.value); err != nil {
+				return "", err
+			} else {
+				options = append(options, fmt.Sprintf("%s = %s", option.name, value))
+			}
+		}
+	}
+	if table_options.GetAutoIncrement() != 0 {
+		options = append(options, fmt.Sprintf("AUTO_INCREMENT = %d", table_options.GetAutoIncrement()))
+	}
+	switch table_options.GetRowFormat() {
+	case pb.RowFormat_ROW_FORMAT_DEFAULT:
+	case pb.RowFormat_DYNAMIC, pb.RowFormat_FIXED, pb.RowFormat_COMPRESSED, pb.RowFormat_REDUNDANT, pb.RowFormat_COMPACT:
+		options = append(options, "ROW_FORMAT = "+table_options.GetRowFormat().String())
+	default:
+		return failBuildQueryPart("unknown row format")
+	}
+	if table_options.GetComment() != "" {
+		var comment string
+		if comment, err = stringLiteralQueryPartBuilder(table_options.GetComment()); err != nil {
+			return "", err
+		} else {
+			options = append(options, "COMMENT = "+comment)
+		}
+	}
+	if table_options.GetKeyBlockSize() != 0 {
+		options = append(options, fmt.Sprintf("KEY_BLOCK_SIZE = %d", table_options.GetKeyBlockSize()))
+	}
+	if len(options) == 0 {
+		return failBuildQueryPart("table options is empty")
+	}
+	return strings.Join(options, " "), nil
+}
 func alterColumnQueryPartBuilder(alter_column *pb.AlterColumn) (query_part string, err error) {
 	if alter_column == nil {
 		return failBuildQueryPart("no alter col data")
-	} else if alter_column.GetColumnName() == "" {
-		return failBuildQueryPart("no alter col name")
+	} else if column_name, err := quoteIdentifier(alter_column.GetColumnName()); err != nil {
+		return "", err
 	} else {
 		switch alter_column.GetType() {
 		case pb.AlterColumnType_SET_DEFAULT_VALUE:
 			if alter_column.GetNewDefaultValue() == nil {
 				return failBuildQueryPart("no alter col new def")
+			} else if default_value, err := defaultValueQueryPartBuilder(alter_column.GetNewDefaultValue()); err != nil {
+				return "", err
 			} else {
-				return fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %v", alter_column.GetColumnName(), alter_column.GetNewDefaultValue()), nil
+				return fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", column_name, default_value), nil
 			}
 		case pb.AlterColumnType_DROP_DEFAULT_VALUE:
-			return fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", alter_column.GetColumnName()), nil
+			return fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", column_name), nil
 		default:
 			return failBuildQueryPart("unknown alter col type")
 		}
 	}
 }
-func selectDataQueryPartBuilder(select_data *pb.SelectData, json_wrap bool) (query_part string, err error) {
+func selectDataQueryPartBuilder(select_data *pb.SelectData) (query_part string, args []any, err error) {
+	return pagedSelectDataQueryPartBuilder(select_data, false, "")
+}
+
+// pagedSelectDataQueryPartBuilder reads one row past Limit of paginated select, see pageRows.
+func pagedSelectDataQueryPartBuilder(select_data *pb.SelectData, paginated bool, page_token string) (query_part string, args []any, err error) {
 	if select_data == nil {
-		return failBuildQueryPart("no select data data (dup, lol)")
-	} else if len(select_data.GetColumnNames()) == 0 {
-		return failBuildQueryPart("col names is empty")
+		return "", nil, buildQueryPartError("no select data")
 	} else {
-		select_expr := strings.Join(select_data.GetColumnNames(), ", ")
-		if json_wrap {
-			select_expr = fmt.Sprintf("JSON_ARRAYAGG(JSON_ARRAY(%s))", select_expr)
+		var select_expr string
+		if select_expr, err = selectExprQueryPartBuilder(select_data.GetColumnNames(), select_data.GetSelectItems()); err != nil {
+			return "", nil, err
 		}
-		query_part = "SELECT " + select_expr
+		if select_data.GetWith() != nil {
+			var with string
+			var with_args []any
+			if with, with_args, err = withClauseQueryPartBuilder(select_data.GetWith()); err != nil {
+				return "", nil, err
+			} else {
+				query_part = with + " "
+				args = append(args, with_args...)
+			}
+		}
+		query_part += "SELECT "
+		if select_data.GetDistinct() {
+			query_part += "DISTINCT "
+		}
+		if select_data.GetCalcFoundRows() {
+			query_part += "SQL_CALC_FOUND_ROWS "
+		}
+		query_part += select_expr
 		if select_data.GetTableName() != "" {
-			query_part += " FROM " + select_data.GetTableName()
+			var table_name string
+			if table_name, err = quoteSchemaObjectName(select_data.GetTableName()); err != nil {
+				return "", nil, err
+			} else {
+				query_part += " FROM " + table_name
+			}
+		}
+		where_conditions := []string{}
+		if select_data.GetWhereCondition() != "" || len(select_data.GetWhereParams()) > 0 || select_data.GetWhereExpr() != nil {
+			var where_condition string
+			var where_args []any
+			if where_condition, where_args, err = conditionQueryPartBuilder(select_data.GetWhereCondition(), select_data.GetWhereParams(), select_data.GetWhereExpr()); err != nil {
+				return "", nil, err
+			} else {
+				where_conditions = append(where_conditions, where_condition)
+				args = append(args, where_args...)
+			}
+		}
+		var offset uint64
+		if page_token != "" {
+			var keyset_condition string
+			var keyset_args []any
+			if keyset_condition, keyset_args, offset, err = keysetQueryPartBuilder(select_data, page_token); err != nil {
+				return "", nil, err
+			} else {
+				where_conditions = append(where_conditions, keyset_condition)
+				args = append(args, keyset_args...)
+			}
 		}
-		if select_data.GetWhereCondition() != "" {
-			query_part += " WHERE " + select_data.GetWhereCondition()
+		if len(where_conditions) == 1 {
+			query_part += " WHERE " + where_conditions[0]
+		} else if len(where_conditions) > 1 {
+			query_part += " WHERE (" + strings.Join(where_conditions, ") AND (") + ")"
 		}
 		if select_data.GetGroupByExpr() != "" {
 			query_part += " GROUP BY " + select_data.GetGroupByExpr()
 		}
-		if select_data.GetHavingCondition() != "" {
-			query_part += " HAVING " + select_data.GetHavingCondition()
+		if select_data.GetHavingCondition() != "" || len(select_data.GetHavingParams()) > 0 || select_data.GetHavingExpr() != nil {
+			var having_condition string
+			var having_args []any
+			if having_condition, having_args, err = conditionQueryPartBuilder(select_data.GetHavingCondition(), select_data.GetHavingParams(), select_data.GetHavingExpr()); err != nil {
+				return "", nil, err
+			} else {
+				query_part += " HAVING " + having_condition
+				args = append(args, having_args...)
+			}
+		}
+		if len(select_data.GetWindows()) > 0 {
+			windows := []string{}
+			for _, named_window := range select_data.GetWindows() {
+				var window_name, window_spec string
+				if named_window.GetName() == "" {
+					return "", nil, buildQueryPartError("no window name")
+				} else if window_name, err = quoteIdentifier(named_window.GetName()); err != nil {
+					return "", nil, err
+				} else if window_spec, err = windowSpecQueryPartBuilder(named_window.GetWindow()); err != nil {
+					return "", nil, err
+				} else {
+					windows = append(windows, fmt.Sprintf("%s AS (%s)", window_name, window_spec))
+				}
+			}
+			query_part += " WINDOW " + strings.Join(windows, ", ")
 		}
 		if select_data.GetOrderBy() != nil {
 			var order_by string
 			if order_by, err = orderByQueryPartBuilder(select_data.GetOrderBy()); err != nil {
-				return "", err
+				return "", nil, err
 			} else {
 				query_part += " " + order_by
 			}
 		}
-		if select_data.GetLimit() != 0 {
+		if paginated && offset > 0 {
+			query_part += fmt.Sprintf(" LIMIT %d OFFSET %d", uint64(select_data.GetLimit())+1, offset)
+		} else if paginated {
+			query_part += fmt.Sprintf(" LIMIT %d", uint64(select_data.GetLimit())+1)
+		} else if select_data.GetLimit() != 0 {
 			query_part += fmt.Sprintf(" LIMIT %d", select_data.GetLimit())
 		}
+		if select_data.GetLockingRead() != nil {
+			var locking_read string
+			if locking_read, err = lockingReadQueryPartBuilder(select_data.GetLockingRead()); err != nil {
+				return "", nil, err
+			} else {
+				query_part += " " + locking_read
+			}
+		}
+		return
+	}
+}
+func withClauseQueryPartBuilder(with *pb.WithClause) (query_part string, args []any, err error) {
+	if with == nil {
+		return "", nil, buildQueryPartError("no with clause data")
+	} else if len(with.GetCommonTableExpressions()) == 0 {
+		return "", nil, buildQueryPartError("cte list is empty")
+	} else {
+		ctes := []string{}
+		for _, cte := range with.GetCommonTableExpressions() {
+			var cte_name, column_names, cte_body string
+			var cte_args []any
+			if cte.GetName() == "" {
+				return "", nil, buildQueryPartError("no cte name")
+			} else if cte_name, err = quoteIdentifier(cte.GetName()); err != nil {
+				return "", nil, err
+			} else if column_names, err = quoteIdentifierList(cte.GetColumnNames(), quoteIdentifier); err != nil {
+				return "", nil, err
+			} else if cte_body, cte_args, err = selectStatementQueryPartBuilder(cte.GetSelectData(), cte.GetCompoundSelect()); err != nil {
+				return "", nil, err
+			}
+			if column_names != "" {
+				cte_name += fmt.Sprintf(" (%s)", column_names)
+			}
+			ctes = append(ctes, fmt.Sprintf("%s AS (%s)", cte_name, cte_body))
+			args = append(args, cte_args...)
+		}
+		if with.GetRecursive() {
+			query_part = "WITH RECURSIVE "
+		} else {
+			query_part = "WITH "
+		}
+		query_part += strings.Join(ctes, ", ")
+		return
+	}
+}
+func lockingReadQueryPartBuilder(locking_read *pb.LockingRead) (query_part string, err error) {
+	switch locking_read.GetMode() {
+	case pb.LockMode_FOR_UPDATE:
+		query_part = "FOR UPDATE"
+	case pb.LockMode_FOR_SHARE:
+		query_part = "FOR SHARE"
+	default:
+		return failBuildQueryPart("unknown lock mode")
+	}
+	if len(locking_read.GetTableNames()) > 0 {
+		var table_names string
+		if table_names, err = quoteIdentifierList(locking_read.GetTableNames(), quoteIdentifier); err != nil {
+			return "", err
+		} else {
+			query_part += " OF " + table_names
+		}
+	}
+	switch locking_read.GetWaitPolicy() {
+	case pb.LockWaitPolicy_WAIT:
+	case pb.LockWaitPolicy_NOWAIT:
+		query_part += " NOWAIT"
+	case pb.LockWaitPolicy_SKIP_LOCKED:
+		query_part += " SKIP LOCKED"
+	default:
+		return failBuildQueryPart("unknown lock wait policy")
+	}
+	return
+}
+func setOperationTypeQueryPartBuilder(set_operation pb.SetOperationType) (query_part string, err error) {
+	switch set_operation {
+	case pb.SetOperationType_UNION:
+		return "UNION", nil
+	case pb.SetOperationType_UNION_ALL:
+		return "UNION ALL", nil
+	case pb.SetOperationType_UNION_DISTINCT:
+		return "UNION DISTINCT", nil
+	case pb.SetOperationType_INTERSECT:
+		return "INTERSECT", nil // mysql 8.0.31+
+	case pb.SetOperationType_EXCEPT:
+		return "EXCEPT", nil // mysql 8.0.31+
+	default:
+		return failBuildQueryPart("unknown set operation type")
+	}
+}
+func compoundSelectQueryPartBuilder(compound_select *pb.CompoundSelect) (query_part string, args []any, err error) {
+	if compound_select == nil {
+		return "", nil, buildQueryPartError("no compound select data")
+	} else if len(compound_select.GetOperands()) < 2 {
+		return "", nil, buildQueryPartError("compound select needs at least 2 operands")
+	} else {
+		for i, operand := range compound_select.GetOperands() {
+			var select_data string
+			var select_args []any
+			if select_data, select_args, err = selectDataQueryPartBuilder(operand.GetSelectData()); err != nil {
+				return "", nil, err
+			}
+			// set operation of the first operand is ignored
+			if i > 0 {
+				var set_operation string
+				if set_operation, err = setOperationTypeQueryPartBuilder(operand.GetSetOperation()); err != nil {
+					return "", nil, err
+				} else {
+					query_part += " " + set_operation + " "
+				}
+			}
+			query_part += fmt.Sprintf("(%s)", select_data)
+			args = append(args, select_args...)
+		}
+		if compound_select.GetOrderBy() != nil {
+			var order_by string
+			if order_by, err = orderByQueryPartBuilder(compound_select.GetOrderBy()); err != nil {
+				return "", nil, err
+			} else {
+				query_part += " " + order_by
+			}
+		}
+		if compound_select.GetLimit() != 0 {
+			query_part += fmt.Sprintf(" LIMIT %d", compound_select.GetLimit())
+		}
 		return
 	}
 }
+
+// selectStatementQueryPartBuilder renders either plain select data or compound select, whichever is set.
+func selectStatementQueryPartBuilder(select_data *pb.SelectData, compound_select *pb.CompoundSelect) (query_part string, args []any, err error) {
+	if compound_select != nil && select_data != nil {
+		return "", nil, buildQueryPartError("select data and compound select are mutually exclusive")
+	} else if compound_select != nil {
+		return compoundSelectQueryPartBuilder(compound_select)
+	} else {
+		return selectDataQueryPartBuilder(select_data)
+	}
+}
+
+// selectExprQueryPartBuilder builds select list of either plain col names or select items.
+func selectExprQueryPartBuilder(column_names []string, select_items []*pb.SelectItem) (query_part string, err error) {
+	if len(column_names) == 0 && len(select_items) == 0 {
+		return failBuildQueryPart("col names is empty")
+	} else if len(column_names) > 0 && len(select_items) > 0 {
+		return failBuildQueryPart("col names and select items are mutually exclusive")
+	} else if len(select_items) > 0 {
+		return selectItemListQueryPartBuilder(select_items)
+	} else {
+		return quoteIdentifierList(column_names, quoteSelectColumnName)
+	}
+}
+func selectItemListQueryPartBuilder(select_items []*pb.SelectItem) (query_part string, err error) {
+	items := make([]string, 0, len(select_items))
+	for _, select_item := range select_items {
+		var item string
+		if item, err = selectItemQueryPartBuilder(select_item); err != nil {
+			return "", err
+		} else {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, ", "), nil
+}
+func selectItemQueryPartBuilder(select_item *pb.SelectItem) (query_part string, err error) {
+	if select_item == nil {
+		return failBuildQueryPart("no select item data")
+	}
+	switch select_item.GetType() {
+	case pb.SelectItemType_COLUMN:
+		if select_item.GetColumnName() == "" {
+			return failBuildQueryPart("no select item col name")
+		} else if query_part, err = quoteSelectColumnName(select_item.GetColumnName()); err != nil {
+			return "", err
+		}
+	case pb.SelectItemType_EXPR:
+		if select_item.GetExpr() == "" {
+			return failBuildQueryPart("no select item expr")
+		} else {
+			query_part = select_item.GetExpr()
+		}
+	case pb.SelectItemType_WINDOW_FUNCTION:
+		if query_part, err = windowFunctionQueryPartBuilder(select_item.GetWindowFunction()); err != nil {
+			return "", err
+		}
+	default:
+		return failBuildQueryPart("unknown select item type")
+	}
+	if select_item.GetAlias() != "" {
+		var alias string
+		if alias, err = quoteIdentifier(select_item.GetAlias()); err != nil {
+			return "", err
+		} else {
+			query_part += " AS " + alias
+		}
+	}
+	return
+}
+
+// windowFunctionArgCount returns min and max arg count of window function.
+func windowFunctionArgCount(window_function_type pb.WindowFunctionType) (min_args int, max_args int) {
+	switch window_function_type {
+	case pb.WindowFunctionType_ROW_NUMBER, pb.WindowFunctionType_RANK, pb.WindowFunctionType_DENSE_RANK,
+		pb.WindowFunctionType_PERCENT_RANK, pb.WindowFunctionType_CUME_DIST:
+		return 0, 0
+	case pb.WindowFunctionType_LAG, pb.WindowFunctionType_LEAD:
+		return 1, 3
+	case pb.WindowFunctionType_NTH_VALUE:
+		return 2, 2
+	default:
+		return 1, 1
+	}
+}
+func windowFunctionQueryPartBuilder(window_function *pb.WindowFunction) (query_part string, err error) {
+	if window_function == nil {
+		return failBuildQueryPart("no window function data")
+	} else if _, ok := pb.WindowFunctionType_name[int32(window_function.GetType())]; !ok {
+		return failBuildQueryPart("unknown window function type")
+	} else if min_args, max_args := windowFunctionArgCount(window_function.GetType()); len(window_function.GetArgs()) < min_args || len(window_function.GetArgs()) > max_args {
+		return failBuildQueryPart("%s takes %d to %d args", window_function.GetType().String(), min_args, max_args)
+	} else if window_function.GetWindowName() != "" && window_function.GetWindow() != nil {
+		return failBuildQueryPart("window name and window spec are mutually exclusive")
+	}
+	query_part = fmt.Sprintf("%s(%s) OVER ", window_function.GetType().String(), strings.Join(window_function.GetArgs(), ", "))
+	if window_function.GetWindowName() != "" {
+		var window_name string
+		if window_name, err = quoteIdentifier(window_function.GetWindowName()); err != nil {
+			return "", err
+		} else {
+			query_part += window_name
+		}
+	} else {
+		var window_spec string
+		if window_spec, err = windowSpecQueryPartBuilder(window_function.GetWindow()); err != nil {
+			return "", err
+		} else {
+			query_part += fmt.Sprintf("(%s)", window_spec)
+		}
+	}
+	return
+}
+func windowSpecQueryPartBuilder(window_spec *pb.WindowSpec) (query_part string, err error) {
+	// empty spec is OVER (), the whole result set is a partition
+	parts := []string{}
+	if window_spec.GetBaseWindowName() != "" {
+		var base_window_name string
+		if base_window_name, err = quoteIdentifier(window_spec.GetBaseWindowName()); err != nil {
+			return "", err
+		} else {
+			parts = append(parts, base_window_name)
+		}
+	}
+	if window_spec.GetPartitionByExpr() != "" {
+		parts = append(parts, "PARTITION BY "+window_spec.GetPartitionByExpr())
+	}
+	if window_spec.GetOrderBy() != nil {
+		var order_by string
+		if order_by, err = orderByQueryPartBuilder(window_spec.GetOrderBy()); err != nil {
+			return "", err
+		} else {
+			parts = append(parts, order_by)
+		}
+	}
+	if window_spec.GetFrame() != nil {
+		var frame string
+		if frame, err = windowFrameQueryPartBuilder(window_spec.GetFrame()); err != nil {
+			return "", err
+		} else {
+			parts = append(parts, frame)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+func windowFrameQueryPartBuilder(frame *pb.WindowFrame) (query_part string, err error) {
+	var start, end string
+	if start, err = windowFrameBoundQueryPartBuilder(frame.GetUnits(), frame.GetStart()); err != nil {
+		return "", err
+	}
+	query_part = frame.GetUnits().String() + " "
+	if frame.GetEnd() == nil {
+		return query_part + start, nil
+	} else if end, err = windowFrameBoundQueryPartBuilder(frame.GetUnits(), frame.GetEnd()); err != nil {
+		return "", err
+	} else {
+		return query_part + fmt.Sprintf("BETWEEN %s AND %s", start, end), nil
+	}
+}
+
+// https://dev.mysql.com/doc/refman/8.0/en/expressions.html#temporal-intervals
+var intervalUnits = map[string]bool{
+	"MICROSECOND": true, "SECOND": true, "MINUTE": true, "HOUR": true, "DAY": true, "WEEK": true,
+	"MONTH": true, "QUARTER": true, "YEAR": true, "SECOND_MICROSECOND": true, "MINUTE_MICROSECOND": true,
+	"MINUTE_SECOND": true, "HOUR_MICROSECOND": true, "HOUR_SECOND": true, "HOUR_MINUTE": true,
+	"DAY_MICROSECOND": true, "DAY_SECOND": true, "DAY_MINUTE": true, "DAY_HOUR": true, "YEAR_MONTH": true,
+}
+
+func isUnsignedNumber(s string, fraction bool) bool {
+	integer, fractional, has_point := strings.Cut(s, ".")
+	if integer == "" || has_point && (!fraction || fractional == "") {
+		return false
+	}
+	for _, r := range integer + fractional {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isFrameBoundExpr reports whether expr is an offset mysql takes in frame of units: unsigned integer
+// for ROWS, unsigned number or INTERVAL <number or quoted string> <unit> for RANGE.
+func isFrameBoundExpr(units pb.WindowFrameUnits, expr string) bool {
+	if units != pb.WindowFrameUnits_RANGE {
+		return isUnsignedNumber(expr, false)
+	} else if isUnsignedNumber(expr, true) {
+		return true
+	}
+	prefix, rest, _ := strings.Cut(expr, " ")
+	i := strings.LastIndexByte(rest, ' ')
+	if !strings.EqualFold(prefix, "INTERVAL") || i < 0 || !intervalUnits[strings.ToUpper(rest[i+1:])] {
+		return false
+	}
+	value := strings.TrimSpace(rest[:i])
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.Trim(value[1:len(value)-1], "0123456789 :.-") == ""
+	}
+	return isUnsignedNumber(value, true)
+}
+func windowFrameBoundQueryPartBuilder(units pb.WindowFrameUnits, bound *pb.WindowFrameBound) (query_part string, err error) {
+	if bound == nil {
+		return failBuildQueryPart("no frame bound data")
+	}
+	switch bound.GetType() {
+	case pb.WindowFrameBoundType_UNBOUNDED_PRECEDING:
+		return "UNBOUNDED PRECEDING", nil
+	case pb.WindowFrameBoundType_UNBOUNDED_FOLLOWING:
+		return "UNBOUNDED FOLLOWING", nil
+	case pb.WindowFrameBoundType_CURRENT_ROW:
+		return "CURRENT ROW", nil
+	case pb.WindowFrameBoundType_PRECEDING, pb.WindowFrameBoundType_FOLLOWING:
+		if bound.GetExpr() == "" {
+			return failBuildQueryPart("no frame bound expr")
+		} else if !isFrameBoundExpr(units, bound.GetExpr()) {
+			return failBuildQueryPart("invalid %s frame bound expr %q", units.String(), bound.GetExpr())
+		} else {
+			return fmt.Sprintf("%s %s", bound.GetExpr(), bound.GetType().String()), nil
+		}
+	default:
+		return failBuildQueryPart("unknown frame bound type")
+	}
+}
 func viewAlgorithmTypeQueryPartBuilder(alg pb.ViewAlgorithmType) string {
 	switch alg {
 	case pb.ViewAlgorithmType_MERGE:
@@ -449,8 +1459,17 @@ func viewAlgorithmTypeQueryPartBuilder(alg pb.ViewAlgorithmType) string {
 		return "ALGORITHM = UNDEFINED"
 	}
 }
-func viewWithCheckOptionTypeQueryPartBuilder(cot pb.ViewWithCheckOptionType) string {
+
+// viewWithCheckOptionTypeQueryPartBuilder omits check option of views which can't be updated
+// (temptable, compound, distinct or grouped select), mysql rejects it for them.
+func viewWithCheckOptionTypeQueryPartBuilder(cot pb.ViewWithCheckOptionType, alg pb.ViewAlgorithmType, select_data *pb.SelectData, compound_select *pb.CompoundSelect) string {
+	if alg == pb.ViewAlgorithmType_TEMPTABLE || compound_select != nil || select_data.GetDistinct() || select_data.GetGroupByExpr() != "" ||
+		select_data.GetHavingCondition() != "" || select_data.GetHavingExpr() != nil {
+		return ""
+	}
 	switch cot {
+	case pb.ViewWithCheckOptionType_CHECK_OPTION_NONE:
+		return ""
 	case pb.ViewWithCheckOptionType_LOCAL:
 		return "WITH LOCAL CHECK OPTION"
 	default:
@@ -471,9 +1490,14 @@ func procedureParameterQueryPartBuilder(pp *pb.ProcedureParameter) (query_part s
 		case pb.ProcedureParameterType_OUT:
 			query_part = "OUT"
 		default:
-			return failBuildQuery("unknown procedure parameter type")
+			return failBuildQueryPart("unknown procedure parameter type")
+		}
+		var param_name string
+		if param_name, err = quoteIdentifier(pp.GetParamName()); err != nil {
+			return "", err
+		} else {
+			query_part += " " + param_name
 		}
-		query_part += " " + pp.GetParamName()
 		data_type := ""
 		if data_type, err = dataTypeQueryPartBuilder(pp.GetDataType()); err != nil {
 			return "", err
@@ -544,7 +1568,15 @@ func dataTypeQueryPartBuilder(dt *pb.DataType) (query_part string, err error) {
 			if len(attrs.GetValues()) == 0 {
 				return failBuildQueryPart("no enum values")
 			} else {
-				query_part += fmt.Sprintf("(%s)", strings.Join(attrs.GetValues(), ", "))
+				values := make([]string, 0, len(attrs.GetValues()))
+				for _, value := range attrs.GetValues() {
+					if value, err = stringLiteralQueryPartBuilder(value); err != nil {
+						return "", err
+					} else {
+						values = append(values, value)
+					}
+				}
+				query_part += fmt.Sprintf("(%s)", strings.Join(values, ", "))
 			}
 		case pb.DataTypeType_BIT,
 			pb.DataTypeType_DATE,
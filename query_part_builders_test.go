@@ -0,0 +1,298 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func TestDataTypeQueryPartBuilderEnum(t *testing.T) {
+	dt := &pb.DataType{Type: pb.DataTypeType_ENUM, EnumAttrs: &pb.EnumAttrs{Values: []string{"a", "it's", "'a'), x INT, y ENUM('b'"}}}
+	want := `ENUM('a', 'it''s', '''a''), x INT, y ENUM(''b''')`
+	if query_part, err := dataTypeQueryPartBuilder(dt); err != nil || query_part != want {
+		t.Errorf("dataTypeQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	}
+	dt.EnumAttrs.Values = []string{`a\`}
+	if query_part, err := dataTypeQueryPartBuilder(dt); err == nil {
+		t.Errorf("dataTypeQueryPartBuilder = %q, want err for backslash", query_part)
+	}
+}
+
+func TestColumnQueryPartBuilderComment(t *testing.T) {
+	column := &pb.Column{ColumnName: "name", DataType: &pb.DataType{Type: pb.DataTypeType_TEXT}, Comment: "user's name"}
+	want := "`name` TEXT COMMENT 'user''s name'"
+	if query_part, err := columnQueryPartBuilder(column); err != nil || query_part != want {
+		t.Errorf("columnQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	}
+}
+
+func TestTableOptionsQueryPartBuilderComment(t *testing.T) {
+	want := "COMMENT = 'users'' table'"
+	if query_part, err := tableOptionsQueryPartBuilder(&pb.TableOptions{Comment: "users' table"}); err != nil || query_part != want {
+		t.Errorf("tableOptionsQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	}
+}
+
+func TestAsQueryPartBuilder(t *testing.T) {
+	if query_part, err := asQueryPartBuilder(&pb.As{Name: "shop.users"}); err != nil || query_part != "AS TABLE `shop`.`users`" {
+		t.Errorf("asQueryPartBuilder = %q, %v", query_part, err)
+	}
+	if query_part, err := asQueryPartBuilder(&pb.As{Name: "users; DROP TABLE x"}); err != nil || query_part != "AS TABLE `users; DROP TABLE x`" {
+		t.Errorf("asQueryPartBuilder = %q, %v", query_part, err)
+	}
+}
+
+func TestWithClauseQueryPartBuilder(t *testing.T) {
+	select_data := &pb.SelectData{
+		With: &pb.WithClause{
+			Recursive: true,
+			CommonTableExpressions: []*pb.CommonTableExpression{{
+				Name:        "nums",
+				ColumnNames: []string{"n"},
+				CompoundSelect: &pb.CompoundSelect{Operands: []*pb.CompoundSelectOperand{
+					{SelectData: &pb.SelectData{SelectItems: []*pb.SelectItem{{Type: pb.SelectItemType_EXPR, Expr: "1"}}}},
+					{SetOperation: pb.SetOperationType_UNION_ALL, SelectData: &pb.SelectData{
+						TableName:      "nums",
+						SelectItems:    []*pb.SelectItem{{Type: pb.SelectItemType_EXPR, Expr: "n + 1"}},
+						WhereCondition: "n < ?",
+						WhereParams:    []*pb.Value{{Type: pb.ValueType_VALUE_INT, IntValue: 10}},
+					}},
+				}},
+			}},
+		},
+		TableName:      "nums",
+		ColumnNames:    []string{"n"},
+		WhereCondition: "n > ?",
+		WhereParams:    []*pb.Value{{Type: pb.ValueType_VALUE_INT, IntValue: 3}},
+	}
+	want := "WITH RECURSIVE `nums` (`n`) AS ((SELECT 1) UNION ALL (SELECT n + 1 FROM `nums` WHERE n < ?)) SELECT `n` FROM `nums` WHERE n > ?"
+	if query_part, args, err := selectDataQueryPartBuilder(select_data); err != nil || query_part != want {
+		t.Errorf("selectDataQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	} else if !reflect.DeepEqual(args, []any{int64(10), int64(3)}) {
+		t.Errorf("selectDataQueryPartBuilder args = %#v, want cte args first", args)
+	}
+
+	select_data.With.CommonTableExpressions = append(select_data.With.CommonTableExpressions, &pb.CommonTableExpression{
+		Name:       "nums",
+		SelectData: &pb.SelectData{SelectItems: []*pb.SelectItem{{Type: pb.SelectItemType_EXPR, Expr: "2"}}},
+	})
+	if err := validateExecutedRequest(&pb.SelectRequest{SelectData: select_data}); err == nil {
+		t.Errorf("validateExecutedRequest of duplicate cte name = nil, want err")
+	}
+}
+
+func TestWindowFunctionQueryPartBuilder(t *testing.T) {
+	select_data := &pb.SelectData{
+		TableName: "orders",
+		SelectItems: []*pb.SelectItem{
+			{Type: pb.SelectItemType_COLUMN, ColumnName: "id"},
+			{Type: pb.SelectItemType_WINDOW_FUNCTION, Alias: "running", WindowFunction: &pb.WindowFunction{
+				Type: pb.WindowFunctionType_SUM,
+				Args: []string{"total"},
+				Window: &pb.WindowSpec{
+					BaseWindowName: "w",
+					Frame: &pb.WindowFrame{
+						Units: pb.WindowFrameUnits_ROWS,
+						Start: &pb.WindowFrameBound{Type: pb.WindowFrameBoundType_PRECEDING, Expr: "2"},
+						End:   &pb.WindowFrameBound{Type: pb.WindowFrameBoundType_CURRENT_ROW},
+					},
+				},
+			}},
+			{Type: pb.SelectItemType_WINDOW_FUNCTION, Alias: "pos", WindowFunction: &pb.WindowFunction{Type: pb.WindowFunctionType_ROW_NUMBER, WindowName: "w"}},
+		},
+		Windows: []*pb.NamedWindow{{Name: "w", Window: &pb.WindowSpec{PartitionByExpr: "user_id", OrderBy: &pb.OrderBy{ColumnNames: []string{"created_at"}}}}},
+	}
+	want := "SELECT `id`, SUM(total) OVER (`w` ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) AS `running`, ROW_NUMBER() OVER `w` AS `pos` " +
+		"FROM `orders` WINDOW `w` AS (PARTITION BY user_id ORDER BY `created_at`)"
+	if query_part, _, err := selectDataQueryPartBuilder(select_data); err != nil || query_part != want {
+		t.Errorf("selectDataQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	}
+	if err := validateExecutedRequest(&pb.SelectRequest{SelectData: select_data}); err != nil {
+		t.Errorf("validateExecutedRequest: %s", err)
+	}
+
+	frame := select_data.SelectItems[1].WindowFunction.Window.Frame
+	frame.Start.Expr = "1) FROM users; --"
+	if err := validateExecutedRequest(&pb.SelectRequest{SelectData: select_data}); err == nil || !strings.Contains(err.Error(), "frame.start.expr: ROWS frame bound must be unsigned integer") {
+		t.Errorf("validateExecutedRequest of injected frame bound = %v", err)
+	}
+	if query_part, _, err := selectDataQueryPartBuilder(select_data); err == nil {
+		t.Errorf("selectDataQueryPartBuilder = %q, want err for injected frame bound", query_part)
+	}
+}
+
+func TestIsFrameBoundExpr(t *testing.T) {
+	for _, tc := range []struct {
+		units pb.WindowFrameUnits
+		expr  string
+		want  bool
+	}{
+		{pb.WindowFrameUnits_ROWS, "3", true},
+		{pb.WindowFrameUnits_ROWS, "1.5", false},
+		{pb.WindowFrameUnits_ROWS, "-1", false},
+		{pb.WindowFrameUnits_ROWS, "INTERVAL 1 DAY", false},
+		{pb.WindowFrameUnits_RANGE, "1.5", true},
+		{pb.WindowFrameUnits_RANGE, "INTERVAL 7 DAY", true},
+		{pb.WindowFrameUnits_RANGE, "interval '1:30' hour_minute", true},
+		{pb.WindowFrameUnits_RANGE, "INTERVAL '1 2:03' DAY_MINUTE", true},
+		{pb.WindowFrameUnits_RANGE, "INTERVAL 1 FORTNIGHT", false},
+		{pb.WindowFrameUnits_RANGE, "INTERVAL '1' OR 1 DAY", false},
+		{pb.WindowFrameUnits_RANGE, "INTERVAL (SELECT 1) DAY", false},
+		{pb.WindowFrameUnits_RANGE, "1e3", false},
+		{pb.WindowFrameUnits_RANGE, "", false},
+	} {
+		if got := isFrameBoundExpr(tc.units, tc.expr); got != tc.want {
+			t.Errorf("isFrameBoundExpr(%s, %q) = %v, want %v", tc.units, tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestExpressionQueryPartBuilder(t *testing.T) {
+	column := func(name string) *pb.Expression {
+		return &pb.Expression{Type: pb.ExpressionType_COLUMN, ColumnName: name}
+	}
+	literal := func(i int64) *pb.Expression {
+		return &pb.Expression{Type: pb.ExpressionType_LITERAL, Value: &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: i}}
+	}
+	expr := &pb.Expression{Type: pb.ExpressionType_OR, Operands: []*pb.Expression{
+		{Type: pb.ExpressionType_AND, Operands: []*pb.Expression{
+			{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_GE, Operands: []*pb.Expression{column("u.age"), literal(18)}},
+			{Type: pb.ExpressionType_BETWEEN, Negated: true, Operands: []*pb.Expression{column("score"), literal(1), literal(5)}},
+		}},
+		{Type: pb.ExpressionType_IN, Operands: []*pb.Expression{column("id"), literal(7), literal(9)}},
+		{Type: pb.ExpressionType_IS_NULL, Negated: true, Operands: []*pb.Expression{
+			{Type: pb.ExpressionType_FUNCTION, FunctionName: "COALESCE", Operands: []*pb.Expression{column("nick"), column("name")}},
+		}},
+		{Type: pb.ExpressionType_EXISTS, Subquery: &pb.SelectData{TableName: "bans", ColumnNames: []string{"id"}, WhereCondition: "level > ?", WhereParams: []*pb.Value{{Type: pb.ValueType_VALUE_INT, IntValue: 2}}}},
+	}}
+	want := "(((`u`.`age` >= ?) AND (`score` NOT BETWEEN ? AND ?)) OR (`id` IN (?, ?)) OR (COALESCE(`nick`, `name`) IS NOT NULL) OR (EXISTS (SELECT `id` FROM `bans` WHERE level > ?)))"
+	want_args := []any{int64(18), int64(1), int64(5), int64(7), int64(9), int64(2)}
+	if query_part, args, err := expressionQueryPartBuilder(expr); err != nil || query_part != want {
+		t.Errorf("expressionQueryPartBuilder = %q, %v, want %q", query_part, err, want)
+	} else if !reflect.DeepEqual(args, want_args) {
+		t.Errorf("expressionQueryPartBuilder args = %#v, want %#v", args, want_args)
+	}
+
+	for _, name := range []string{"*", "u.*"} {
+		wildcard := &pb.Expression{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_EQ, Operands: []*pb.Expression{column(name), literal(1)}}
+		if query_part, _, err := expressionQueryPartBuilder(wildcard); err == nil {
+			t.Errorf("expressionQueryPartBuilder = %q, want err for %s operand", query_part, name)
+		}
+		request := &pb.DeleteRequest{TableName: "users", WhereExpr: wildcard}
+		if err := validateExecutedRequest(request); err == nil || !strings.Contains(err.Error(), "where_expr.operands[0].column_name") {
+			t.Errorf("validateExecutedRequest of %s operand = %v", name, err)
+		}
+	}
+}
+
+func TestIndexQueryPartBuilder(t *testing.T) {
+	for _, tc := range []struct {
+		index *pb.Index
+		want  string
+	}{
+		{
+			&pb.Index{
+				IndexName: "name_idx",
+				Type:      pb.IndexType_UNIQUE,
+				KeyParts:  []*pb.IndexKeyPart{{ColumnName: "last_name", Length: 10}, {ColumnName: "created_at", Descending: true}},
+				Options:   &pb.IndexOptions{Using: pb.IndexUsing_BTREE, Comment: "user's name", Invisible: true},
+			},
+			"UNIQUE INDEX `name_idx` (`last_name`(10), `created_at` DESC) USING BTREE COMMENT 'user''s name' INVISIBLE",
+		},
+		{
+			&pb.Index{Type: pb.IndexType_FULLTEXT, KeyParts: []*pb.IndexKeyPart{{ColumnName: "body"}}, Options: &pb.IndexOptions{Parser: "ngram"}},
+			"FULLTEXT INDEX (`body`) WITH PARSER `ngram`",
+		},
+		{
+			&pb.Index{IndexName: "area", Type: pb.IndexType_SPATIAL, KeyParts: []*pb.IndexKeyPart{{ColumnName: "shape"}}},
+			"SPATIAL INDEX `area` (`shape`)",
+		},
+	} {
+		if query_part, err := indexQueryPartBuilder(tc.index); err != nil || query_part != tc.want {
+			t.Errorf("indexQueryPartBuilder = %q, %v, want %q", query_part, err, tc.want)
+		}
+	}
+
+	if query_part, err := indexAlgorithmLockQueryPartBuilder(pb.IndexAlgorithm_INPLACE, pb.IndexLock_NONE); err != nil || query_part != "ALGORITHM = INPLACE LOCK = NONE" {
+		t.Errorf("indexAlgorithmLockQueryPartBuilder = %q, %v", query_part, err)
+	}
+	if query_part, err := indexKeyPartListQueryPartBuilder([]*pb.IndexKeyPart{{ColumnName: "a) , DROP TABLE x; --"}}); err != nil || query_part != "`a) , DROP TABLE x; --`" {
+		t.Errorf("indexKeyPartListQueryPartBuilder = %q, %v", query_part, err)
+	}
+	if query_part, err := indexKeyPartListQueryPartBuilder(nil); err == nil {
+		t.Errorf("indexKeyPartListQueryPartBuilder = %q, want err for no key parts", query_part)
+	}
+}
+
+func TestCheckQueryPartBuilder(t *testing.T) {
+	condition_expr := &pb.Expression{Type: pb.ExpressionType_AND, Operands: []*pb.Expression{
+		{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_GE, Operands: []*pb.Expression{
+			{Type: pb.ExpressionType_COLUMN, ColumnName: "age"},
+			{Type: pb.ExpressionType_LITERAL, Value: &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: 18}},
+		}},
+		{Type: pb.ExpressionType_COMPARISON, Operator: pb.ComparisonOperator_NE, Operands: []*pb.Expression{
+			{Type: pb.ExpressionType_COLUMN, ColumnName: "name"},
+			{Type: pb.ExpressionType_LITERAL, Value: &pb.Value{Type: pb.ValueType_VALUE_STRING, StringValue: "it's"}},
+		}},
+	}}
+	for _, tc := range []struct {
+		check *pb.Check
+		want  string
+	}{
+		{&pb.Check{ConstraintSymbol: "adult", ConditionExpr: condition_expr}, "CONSTRAINT `adult` CHECK (((`age` >= 18) AND (`name` <> 'it''s'))) ENFORCED"},
+		{&pb.Check{Condition: "price > 0", NotEnforced: true}, "CHECK (price > 0) NOT ENFORCED"},
+	} {
+		if query_part, err := checkQueryPartBuilder(tc.check); err != nil || query_part != tc.want {
+			t.Errorf("checkQueryPartBuilder = %q, %v, want %q", query_part, err, tc.want)
+		}
+	}
+	if query_part, err := alterCheckQueryPartBuilder(&pb.AlterCheck{ConstraintSymbol: "adult", NotEnforced: true}); err != nil || query_part != "ALTER CHECK `adult` NOT ENFORCED" {
+		t.Errorf("alterCheckQueryPartBuilder = %q, %v", query_part, err)
+	}
+	if query_part, err := dropCheckQueryPartBuilder(&pb.DropCheck{ConstraintSymbol: "adult"}); err != nil || query_part != "DROP CHECK `adult`" {
+		t.Errorf("dropCheckQueryPartBuilder = %q, %v", query_part, err)
+	}
+	if query_part, err := checkQueryPartBuilder(&pb.Check{Condition: "price > 0", ConditionExpr: condition_expr}); err == nil {
+		t.Errorf("checkQueryPartBuilder = %q, want err for condition and expr", query_part)
+	}
+}
+
+func TestForeignKeyQueryPartBuilder(t *testing.T) {
+	for _, tc := range []struct {
+		fk   *pb.ForeignKey
+		want string
+	}{
+		{
+			&pb.ForeignKey{
+				ConstraintSymbol: "order_user",
+				IndexName:        "user_idx",
+				ColumnNames:      []string{"user_id", "tenant_id"},
+				ParentTableName:  "shop.users",
+				ParentKeyParts:   []string{"id", "tenant_id"},
+				Match:            pb.ForeignKeyMatch_SIMPLE,
+				OnDelete:         pb.ReferenceOption_CASCADE,
+				OnUpdate:         pb.ReferenceOption_SET_NULL,
+			},
+			"CONSTRAINT `order_user` FOREIGN KEY `user_idx` (`user_id`, `tenant_id`) REFERENCES `shop`.`users`(`id`, `tenant_id`) MATCH SIMPLE ON DELETE CASCADE ON UPDATE SET NULL",
+		},
+		{
+			&pb.ForeignKey{ColumnNames: []string{"user_id"}, ParentTableName: "users", ParentKeyParts: []string{"id"}, OnUpdate: pb.ReferenceOption_NO_ACTION},
+			"FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON UPDATE NO ACTION",
+		},
+	} {
+		if query_part, err := foreignKeyQueryPartBuilder(tc.fk); err != nil || query_part != tc.want {
+			t.Errorf("foreignKeyQueryPartBuilder = %q, %v, want %q", query_part, err, tc.want)
+		}
+	}
+	for _, fk := range []*pb.ForeignKey{
+		{ColumnNames: []string{"a", "b"}, ParentTableName: "users", ParentKeyParts: []string{"id"}},
+		{ColumnNames: []string{"user_id"}, ParentTableName: "users", ParentKeyParts: []string{"id"}, OnDelete: pb.ReferenceOption(42)},
+		{ColumnNames: []string{"user_id"}, ParentTableName: "users", ParentKeyParts: []string{"id"}, Match: pb.ForeignKeyMatch(42)},
+	} {
+		if query_part, err := foreignKeyQueryPartBuilder(fk); err == nil {
+			t.Errorf("foreignKeyQueryPartBuilder = %q, want err", query_part)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+// prettyClauseKeywords start a new line when found outside of parens, spelled as builders emit them.
+// Longer keywords go first, so that e.g. NATURAL LEFT OUTER JOIN isn't split before LEFT.
+var prettyClauseKeywords = []string{
+	"FROM", "WHERE", "GROUP BY", "HAVING", "ORDER BY", "LIMIT",
+	"NATURAL LEFT OUTER JOIN", "NATURAL RIGHT OUTER JOIN", "NATURAL JOIN",
+	"INNER JOIN", "CROSS JOIN", "LEFT OUTER JOIN", "RIGHT OUTER JOIN", "STRAIGHT_JOIN",
+	"ON DUPLICATE KEY UPDATE", "VALUES", "SELECT", "UNION", "INTERSECT", "EXCEPT",
+}
+
+// prettyQuery puts top level clauses of query on separate lines, literals and comments are kept as is.
+// SET starts a clause only in UPDATE, elsewhere it's part of e.g. ON DELETE SET NULL.
+func prettyQuery(query string) string {
+	code := make([]bool, len(query))
+	scanCode(query, func(offset int) { code[offset] = true })
+	keywords := prettyClauseKeywords
+	if len(query) >= len("UPDATE ") && strings.EqualFold(query[:len("UPDATE ")], "UPDATE ") {
+		keywords = append(slices.Clone(keywords), "SET")
+	}
+
+	builder, depth := strings.Builder{}, 0
+	for i := 0; i < len(query); i++ {
+		if code[i] {
+			if query[i] == '(' {
+				depth++
+			} else if query[i] == ')' && depth > 0 {
+				depth--
+			} else if query[i] == ' ' && depth == 0 && i+1 < len(query) && code[i+1] {
+				if keyword := prettyClauseStart(query[i+1:], keywords); keyword != "" {
+					builder.WriteByte('\n')
+					builder.WriteString(query[i+1 : i+1+len(keyword)])
+					i += len(keyword)
+					continue
+				}
+			}
+		}
+		builder.WriteByte(query[i])
+	}
+	return builder.String()
+}
+
+// prettyClauseStart returns keyword which rest starts with, or "".
+func prettyClauseStart(rest string, keywords []string) string {
+	for _, keyword := range keywords {
+		if len(rest) >= len(keyword) && strings.EqualFold(rest[:len(keyword)], keyword) &&
+			(len(rest) == len(keyword) || rest[len(keyword)] == ' ' || rest[len(keyword)] == ';') {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// renderOperation builds operation like the matching rpc would, without executing it. Query is the
+// script which runs: USE of database_name (outside of client transaction) goes before the statement,
+// SELECT FOUND_ROWS() of CalcFoundRows after it. Params bind placeholders of the statement.
+func renderOperation(operation *pb.Operation, pretty bool) (query string, params []*pb.Value, err error) {
+	var args []any
+	v := &validator{}
+	v.operation("operation", operation)
+	if err = v.err(); err != nil {
+		return "", nil, err
+	} else if query, args, err = operationQueryBuilder(operation); err != nil {
+		return "", nil, err
+	}
+	for _, arg := range args {
+		var param *pb.Value
+		if param, err = argValue(arg); err != nil {
+			return "", nil, buildQueryError("%s", err.Error())
+		} else {
+			params = append(params, param)
+		}
+	}
+	if pretty {
+		query = prettyQuery(query)
+	}
+	statements := []string{query}
+	_, request, _ := operationRequest(operation)
+	if r, ok := request.(interface {
+		GetDatabaseName() string
+		GetTransactionId() string
+	}); ok && r.GetDatabaseName() != "" && r.GetTransactionId() == "" && !operationNamesDatabase(operation) {
+		var use_database string
+		if use_database, err = useDatabaseQuery(r.GetDatabaseName()); err != nil {
+			return "", nil, err
+		}
+		statements = append([]string{use_database}, statements...)
+	}
+	if operation.GetType() == pb.OperationType_SELECT && operation.GetSelect().GetSelectData().GetCalcFoundRows() {
+		statements = append(statements, foundRowsQuery)
+	}
+	if len(statements) == 1 {
+		return query, params, nil
+	}
+	separator := "; "
+	if pretty {
+		separator = ";\n"
+	}
+	return strings.Join(statements, separator), params, nil
+}
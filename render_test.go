@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func TestPrettyQuery(t *testing.T) {
+	for _, tc := range []struct{ query, want string }{
+		{
+			"SELECT `a` FROM `t` NATURAL LEFT OUTER JOIN `u` WHERE `a` = 'x FROM y' ORDER BY `a` LIMIT 1",
+			"SELECT `a`\nFROM `t`\nNATURAL LEFT OUTER JOIN `u`\nWHERE `a` = 'x FROM y'\nORDER BY `a`\nLIMIT 1",
+		},
+		{
+			"SELECT * FROM `t` LEFT OUTER JOIN `u` ON (`t`.`id` = `u`.`id`) STRAIGHT_JOIN `v` RIGHT OUTER JOIN `w` USING (`id`)",
+			"SELECT *\nFROM `t`\nLEFT OUTER JOIN `u` ON (`t`.`id` = `u`.`id`)\nSTRAIGHT_JOIN `v`\nRIGHT OUTER JOIN `w` USING (`id`)",
+		},
+		{
+			"SELECT `a` FROM `t` WHERE `a` IN (SELECT `a` FROM `u`) EXCEPT SELECT `a` FROM `v`",
+			"SELECT `a`\nFROM `t`\nWHERE `a` IN (SELECT `a` FROM `u`)\nEXCEPT\nSELECT `a`\nFROM `v`",
+		},
+		{
+			"UPDATE `t` SET `a` = 1 WHERE `id` = 2",
+			"UPDATE `t`\nSET `a` = 1\nWHERE `id` = 2",
+		},
+		{
+			"ALTER TABLE `t` ADD FOREIGN KEY (`u_id`) REFERENCES `u` (`id`) ON DELETE SET NULL ON UPDATE SET DEFAULT",
+			"ALTER TABLE `t` ADD FOREIGN KEY (`u_id`) REFERENCES `u` (`id`) ON DELETE SET NULL ON UPDATE SET DEFAULT",
+		},
+	} {
+		if got := prettyQuery(tc.query); got != tc.want {
+			t.Errorf("prettyQuery(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestRenderOperationScript(t *testing.T) {
+	select_data := &pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, CalcFoundRows: true}
+	for _, tc := range []struct {
+		operation *pb.Operation
+		pretty    bool
+		want      string
+	}{
+		{
+			&pb.Operation{Type: pb.OperationType_SELECT, Select: &pb.SelectRequest{SelectData: select_data, DatabaseName: "shop"}},
+			false,
+			"USE `shop`; SELECT SQL_CALC_FOUND_ROWS `id` FROM `users`; SELECT FOUND_ROWS()",
+		},
+		{
+			&pb.Operation{Type: pb.OperationType_SELECT, Select: &pb.SelectRequest{SelectData: select_data, DatabaseName: "shop"}},
+			true,
+			"USE `shop`;\nSELECT SQL_CALC_FOUND_ROWS `id`\nFROM `users`;\nSELECT FOUND_ROWS()",
+		},
+		{
+			// client transaction chose its db on begin
+			&pb.Operation{Type: pb.OperationType_DELETE, Delete: &pb.DeleteRequest{TableName: "users", DatabaseName: "shop", TransactionId: "tx"}},
+			false,
+			"DELETE FROM `users`",
+		},
+		{
+			&pb.Operation{Type: pb.OperationType_CREATE_DATABASE, CreateDatabase: &pb.CreateDatabaseRequest{DatabaseName: "shop"}},
+			false,
+			"CREATE DATABASE `shop`;",
+		},
+	} {
+		if query, _, err := renderOperation(tc.operation, tc.pretty); err != nil || query != tc.want {
+			t.Errorf("renderOperation = %q, %v, want %q", query, err, tc.want)
+		}
+	}
+}
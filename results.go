@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+func scanResultColumns(rows *sql.Rows) (columns []*pb.ResultColumn, err error) {
+	column_types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types, err: %w", err)
+	}
+	for _, column_type := range column_types {
+		nullable, _ := column_type.Nullable()
+		columns = append(columns, &pb.ResultColumn{
+			Name:         column_type.Name(),
+			DatabaseType: column_type.DatabaseTypeName(),
+			Nullable:     nullable,
+		})
+	}
+	return columns, nil
+}
+
+func scanResultRow(rows *sql.Rows, columns []*pb.ResultColumn) (row *pb.ResultRow, err error) {
+	raw_values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range raw_values {
+		dest[i] = &raw_values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to scan row, err: %w", err)
+	}
+	row = &pb.ResultRow{Values: make([]*pb.Value, len(columns))}
+	for i, raw_value := range raw_values {
+		row.Values[i] = resultCell(columns[i].GetDatabaseType(), raw_value)
+	}
+	return row, nil
+}
+
+// resultCell converts raw text protocol value into typed cell, RawBytes is copied.
+func resultCell(database_type string, raw_value sql.RawBytes) *pb.Value {
+	if raw_value == nil {
+		return &pb.Value{Type: pb.ValueType_VALUE_NULL}
+	}
+	switch database_type {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if v, err := strconv.ParseInt(string(raw_value), 10, 64); err == nil {
+			return &pb.Value{Type: pb.ValueType_VALUE_INT, IntValue: v}
+		}
+	case "FLOAT", "DOUBLE":
+		if v, err := strconv.ParseFloat(string(raw_value), 64); err == nil {
+			return &pb.Value{Type: pb.ValueType_VALUE_DOUBLE, DoubleValue: v}
+		}
+	case "BINARY", "VARBINARY", "BLOB", "BIT", "GEOMETRY":
+		return &pb.Value{Type: pb.ValueType_VALUE_BYTES, BytesValue: append([]byte{}, raw_value...)}
+	default:
+		if strings.HasPrefix(database_type, "UNSIGNED ") {
+			if v, err := strconv.ParseUint(string(raw_value), 10, 64); err == nil {
+				return &pb.Value{Type: pb.ValueType_VALUE_UINT, UintValue: v}
+			}
+		}
+	}
+	// DECIMAL, dates, JSON, text types; decimals stay strings to keep precision
+	return &pb.Value{Type: pb.ValueType_VALUE_STRING, StringValue: string(raw_value)}
+}
+
+// resultRowsJSON renders rows as legacy JSON array of arrays (like JSON_ARRAYAGG(JSON_ARRAY(...))).
+func resultRowsJSON(columns []*pb.ResultColumn, rows []*pb.ResultRow) (string, error) {
+	data := make([][]any, 0, len(rows))
+	for _, row := range rows {
+		values := make([]any, len(row.GetValues()))
+		for i, value := range row.GetValues() {
+			switch value.GetType() {
+			case pb.ValueType_VALUE_NULL:
+				values[i] = nil
+			case pb.ValueType_VALUE_INT:
+				values[i] = value.GetIntValue()
+			case pb.ValueType_VALUE_UINT:
+				values[i] = value.GetUintValue()
+			case pb.ValueType_VALUE_DOUBLE:
+				values[i] = value.GetDoubleValue()
+			case pb.ValueType_VALUE_BYTES:
+				values[i] = value.GetBytesValue() // base64
+			default:
+				if columns[i].GetDatabaseType() == "DECIMAL" {
+					values[i] = json.Number(value.GetStringValue())
+				} else {
+					values[i] = value.GetStringValue()
+				}
+			}
+		}
+		data = append(data, values)
+	}
+	if b, err := json.Marshal(data); err != nil {
+		return "", fmt.Errorf("failed to marshal rows, err: %w", err)
+	} else {
+		return string(b), nil
+	}
+}
+
+// queryWarnings reads SHOW WARNINGS of the last statement, must run on the same conn right after it.
+func queryWarnings(ctx context.Context, tx *sql.Tx) (warnings []*pb.Warning, err error) {
+	rows, err := tx.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query warnings, err: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		warning := &pb.Warning{}
+		if err = rows.Scan(&warning.Level, &warning.Code, &warning.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan warning, err: %w", err)
+		}
+		warnings = append(warnings, warning)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read warnings, err: %w", err)
+	}
+	return warnings, nil
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	pb "greateapot.re/dblabs-api"
 )
@@ -12,480 +15,615 @@ import (
 type ApiServer struct {
 	pb.UnimplementedApiServer
 
-	DB *sql.DB
+	DB           *sql.DB
+	Transactions *transactionRegistry
 }
 
-func (s *ApiServer) execQuery(ctx context.Context, query string) error {
-	tx, err := s.DB.Begin()
+// inTx runs fn on client transaction transaction_id, or on own tx which is committed
+// if fn succeeds when transaction_id is empty. Non-empty database_name becomes the
+// default database of the tx conn.
+func (s *ApiServer) inTx(ctx context.Context, transaction_id string, database_name string, fn func(tx *sql.Tx) error) error {
+	return s.inSessionTx(ctx, transaction_id, database_name, false, fn)
+}
+
+// inSessionTx is inTx, which doesn't return conn to the pool afterwards (or after client transaction)
+// if session_state is set: fn leaves session state behind (see leavesSessionState).
+func (s *ApiServer) inSessionTx(ctx context.Context, transaction_id string, database_name string, session_state bool, fn func(tx *sql.Tx) error) error {
+	if transaction_id != "" {
+		if session_state {
+			s.Transactions.markSessionState(transaction_id)
+		}
+		return s.Transactions.run(ctx, transaction_id, database_name, fn)
+	}
+
+	conn, err := s.DB.Conn(ctx)
 	if err != nil {
-		return fmt.Errorf("failed begin tx, err: %s", err.Error())
+		return fmt.Errorf("failed to get conn, err: %w", err)
 	}
-	defer tx.Rollback()
+	defer resetConn(conn, database_name, session_state)
 
-	if SrvConf.LogQueries {
-		log.Printf("Executing query: %s", query)
+	if database_name != "" {
+		if err = useDatabase(ctx, conn, database_name); err != nil {
+			return err
+		}
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed begin tx, err: %w", err)
 	}
-	if _, err = tx.ExecContext(ctx, query); err != nil {
-		return fmt.Errorf("failed exec, err: %s; query: %s", err.Error(), query)
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
 	} else if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit changes, err: %s", err.Error())
+		return fmt.Errorf("failed to commit changes, err: %w", err)
 	} else {
 		return nil
 	}
 }
 
-func (s *ApiServer) queryQuery(ctx context.Context, query string) (string, error) {
-	tx, err := s.DB.Begin()
+func useDatabaseQuery(database_name string) (query string, err error) {
+	if quoted_database_name, err := quoteIdentifier(database_name); err != nil {
+		return "", err
+	} else {
+		return "USE " + quoted_database_name, nil
+	}
+}
+
+func useDatabase(ctx context.Context, conn *sql.Conn, database_name string) error {
+	if query, err := useDatabaseQuery(database_name); err != nil {
+		return err
+	} else if _, err = conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to use db, err: %w", err)
+	} else {
+		return nil
+	}
+}
+
+// leavesSessionState reports whether request (of operation) changes session of conn: user and session
+// variables, temporary tables; procedures may do any of it.
+func leavesSessionState(request any) bool {
+	switch r := request.(type) {
+	case *pb.SetRequest, *pb.CallProcedureRequest:
+		return true
+	case *pb.CreateTableRequest:
+		return r.GetTemporary()
+	default:
+		return false
+	}
+}
+
+// releaseConn returns conn to the pool, or closes it when it has session state
+// (default database) which mustn't leak to other requests.
+func releaseConn(conn *sql.Conn, discard bool) {
+	if discard {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
+
+const resetConnTimeout = 5 * time.Second
+
+// resetConn releases conn which used database_name: its default database is switched back to the one
+// of DSN. mysql can't unset it, so conn is discarded if DSN has none (or USE fails).
+func resetConn(conn *sql.Conn, database_name string, session_state bool) {
+	discard := session_state
+	if !discard && database_name != "" && database_name != SrvConf.DatabaseName {
+		// request ctx may be done already
+		ctx, cancel := context.WithTimeout(context.Background(), resetConnTimeout)
+		defer cancel()
+		discard = SrvConf.DatabaseName == "" || useDatabase(ctx, conn, SrvConf.DatabaseName) != nil
+	}
+	releaseConn(conn, discard)
+}
+
+// execTx executes query on tx and collects its result, and its warnings (on the same conn) when
+// CollectWarnings is set: driver drops warning count of OK packet, so it costs a roundtrip each time.
+func execTx(ctx context.Context, tx *sql.Tx, query string, args ...any) (*pb.OkResponse, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		return "", fmt.Errorf("failed begin tx, err: %s", err.Error())
+		return nil, fmt.Errorf("failed exec, err: %w", err)
 	}
-	defer tx.Rollback()
+	response := &pb.OkResponse{Ok: true}
+	// zero when statement doesn't report them
+	response.RowsAffected, _ = result.RowsAffected()
+	response.LastInsertId, _ = result.LastInsertId()
+	if !SrvConf.CollectWarnings {
+		return response, nil
+	}
+	if response.Warnings, err = queryWarnings(ctx, tx); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (s *ApiServer) execQuery(ctx context.Context, transaction_id string, database_name string, query string, args ...any) (response *pb.OkResponse, err error) {
+	return s.execSessionQuery(ctx, transaction_id, database_name, false, query, args...)
+}
 
-	if SrvConf.LogQueries {
-		log.Printf("Querying query: %s", query)
-	}
-	var data sql.NullString
-	row := tx.QueryRowContext(ctx, query)
-	if err := row.Scan(&data); err != nil {
-		return "", fmt.Errorf("failed to scan row, err: %s; query: %s", err.Error(), query)
-	} else if err := tx.Commit(); err != nil {
-		return "", fmt.Errorf("failed to commit changes, err: %s", err.Error())
-	} else {
-		if data.Valid {
-			return data.String, nil
+// execSessionQuery is execQuery of statement which may leave session state, see inSessionTx.
+func (s *ApiServer) execSessionQuery(ctx context.Context, transaction_id string, database_name string, session_state bool, query string, args ...any) (response *pb.OkResponse, err error) {
+	err = s.inSessionTx(ctx, transaction_id, database_name, session_state, func(tx *sql.Tx) (err error) {
+		if SrvConf.LogQueries {
+			log.Printf("Executing query: %s; args: %v", query, args)
+		}
+		response, err = execTx(ctx, tx, query, args...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// queryTx runs query on tx and scans all of its rows.
+func queryTx(ctx context.Context, tx *sql.Tx, query string, args ...any) (columns []*pb.ResultColumn, result_rows []*pb.ResultRow, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed query, err: %w", err)
+	}
+	defer rows.Close()
+
+	if columns, err = scanResultColumns(rows); err != nil {
+		return nil, nil, err
+	}
+	result_rows = []*pb.ResultRow{}
+	for rows.Next() {
+		if row, err := scanResultRow(rows, columns); err != nil {
+			return nil, nil, err
 		} else {
-			return "[]", nil
+			result_rows = append(result_rows, row)
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read rows, err: %w", err)
+	}
+	return columns, result_rows, nil
 }
 
-func (s *ApiServer) AlterDatabase(ctx context.Context, request *pb.AlterDatabaseRequest) (*pb.OkResponse, error) {
-	if query, err := alterDatabaseQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
+func (s *ApiServer) queryRows(ctx context.Context, transaction_id string, database_name string, query string, args ...any) (columns []*pb.ResultColumn, result_rows []*pb.ResultRow, err error) {
+	columns, result_rows, _, err = s.queryFoundRows(ctx, transaction_id, database_name, false, query, args...)
+	return
+}
+
+const foundRowsQuery = "SELECT FOUND_ROWS()"
+
+// queryFoundRows is queryRows which also reads FOUND_ROWS() of SQL_CALC_FOUND_ROWS query
+// when calc_found_rows is set, it has to run on the same conn right after the query.
+func (s *ApiServer) queryFoundRows(ctx context.Context, transaction_id string, database_name string, calc_found_rows bool, query string, args ...any) (columns []*pb.ResultColumn, result_rows []*pb.ResultRow, found_rows uint64, err error) {
+	err = s.inTx(ctx, transaction_id, database_name, func(tx *sql.Tx) (err error) {
+		if SrvConf.LogQueries {
+			log.Printf("Querying query: %s; args: %v", query, args)
+		}
+		if columns, result_rows, err = queryTx(ctx, tx, query, args...); err != nil {
+			return err
+		} else if calc_found_rows {
+			if err = tx.QueryRowContext(ctx, foundRowsQuery).Scan(&found_rows); err != nil {
+				return fmt.Errorf("failed to get found rows, err: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return columns, result_rows, found_rows, nil
+}
+
+// queryTable fills TableResponse in requested format, JSON is the legacy one.
+// Both are built from scanned rows, so ORDER BY and LIMIT apply to rows as in plain sql.
+func (s *ApiServer) queryTable(ctx context.Context, transaction_id string, database_name string, format pb.ResultFormat, query string, args ...any) (*pb.TableResponse, error) {
+	if columns, rows, err := s.queryRows(ctx, transaction_id, database_name, query, args...); err != nil {
+		return nil, err
+	} else {
+		return tableResponse(format, columns, rows)
+	}
+}
+
+func tableResponse(format pb.ResultFormat, columns []*pb.ResultColumn, rows []*pb.ResultRow) (*pb.TableResponse, error) {
+	if format != pb.ResultFormat_JSON {
+		return &pb.TableResponse{Ok: true, Columns: columns, Rows: rows}, nil
+	} else if data, err := resultRowsJSON(columns, rows); err != nil {
+		return nil, err
+	} else {
+		return &pb.TableResponse{Ok: true, Data: data}, nil
+	}
+}
+
+// streamRows sends rows in chunks of chunk_size as they are read, the last chunk is marked Done
+// and carries TotalRows. Cancelled ctx (client gone) stops the query.
+func (s *ApiServer) streamRows(ctx context.Context, transaction_id string, database_name string, chunk_size uint32, send func(*pb.TableChunk) error, query string, args ...any) error {
+	if chunk_size == 0 {
+		chunk_size = SrvConf.StreamChunkSize
+	}
+
+	total_rows := uint64(0)
+	var last_chunk *pb.TableChunk
+	err := s.inTx(ctx, transaction_id, database_name, func(tx *sql.Tx) error {
+		if SrvConf.LogQueries {
+			log.Printf("Streaming query: %s; args: %v", query, args)
+		}
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed query, err: %w", err)
+		}
+		defer rows.Close()
+
+		columns, err := scanResultColumns(rows)
+		if err != nil {
+			return err
+		}
+		chunk := &pb.TableChunk{Ok: true, Columns: columns}
+		for rows.Next() {
+			if row, err := scanResultRow(rows, columns); err != nil {
+				return err
+			} else {
+				chunk.Rows = append(chunk.Rows, row)
+				total_rows++
+			}
+			if len(chunk.Rows) == int(chunk_size) {
+				if err := send(chunk); err != nil {
+					return fmt.Errorf("failed to send chunk, err: %w", err)
+				}
+				chunk = &pb.TableChunk{Ok: true}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read rows, err: %w", err)
+		}
+		last_chunk = chunk
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the last chunk is sent after commit, Done means that all rows were read successfully
+	last_chunk.Done = true
+	last_chunk.TotalRows = total_rows
+	if err := send(last_chunk); err != nil {
+		return fmt.Errorf("failed to send chunk, err: %w", err)
+	}
+	return nil
+}
+
+func (s *ApiServer) BeginTransaction(ctx context.Context, request *pb.BeginTransactionRequest) (*pb.TransactionResponse, error) {
+	if err := validateRequest(request); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if transaction_id, err := s.Transactions.begin(ctx, request.GetReadOnly(), request.GetDatabaseName()); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return &pb.TransactionResponse{
+			Ok:            true,
+			TransactionId: transaction_id,
 		}, nil
+	}
+}
+func (s *ApiServer) Commit(ctx context.Context, request *pb.TransactionRequest) (*pb.OkResponse, error) {
+	if request.GetTransactionId() == "" {
+		return nil, buildErrorStatus(errors.New("no transaction id"))
+	} else if err := s.Transactions.finish(request.GetTransactionId(), true); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
 		return &pb.OkResponse{
 			Ok: true,
 		}, nil
 	}
 }
-func (s *ApiServer) AlterTable(ctx context.Context, request *pb.AlterTableRequest) (*pb.OkResponse, error) {
-	if query, err := alterTableQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+func (s *ApiServer) Rollback(ctx context.Context, request *pb.TransactionRequest) (*pb.OkResponse, error) {
+	if request.GetTransactionId() == "" {
+		return nil, buildErrorStatus(errors.New("no transaction id"))
+	} else if err := s.Transactions.finish(request.GetTransactionId(), false); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
 		return &pb.OkResponse{
 			Ok: true,
 		}, nil
 	}
 }
+
+func (s *ApiServer) AlterDatabase(ctx context.Context, request *pb.AlterDatabaseRequest) (*pb.OkResponse, error) {
+	if query, args, err := buildQuery(request, alterDatabaseQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), "", query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return response, nil
+	}
+}
+func (s *ApiServer) AlterTable(ctx context.Context, request *pb.AlterTableRequest) (*pb.OkResponse, error) {
+	if query, args, err := buildQuery(request, alterTableQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return response, nil
+	}
+}
 func (s *ApiServer) CreateDatabase(ctx context.Context, request *pb.CreateDatabaseRequest) (*pb.OkResponse, error) {
-	if query, err := createDatabaseQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, createDatabaseQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), "", query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) CreateTable(ctx context.Context, request *pb.CreateTableRequest) (*pb.OkResponse, error) {
-	if query, err := createTableQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, createTableQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execSessionQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), leavesSessionState(request), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) DropDatabase(ctx context.Context, request *pb.DropDatabaseRequest) (*pb.OkResponse, error) {
-	if query, err := dropDatabaseQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, dropDatabaseQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), "", query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) DropTable(ctx context.Context, request *pb.DropTableRequest) (*pb.OkResponse, error) {
-	if query, err := dropTableQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, dropTableQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) RenameTable(ctx context.Context, request *pb.RenameTableRequest) (*pb.OkResponse, error) {
-	if query, err := renameTableQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, renameTableQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) TruncateTable(ctx context.Context, request *pb.TruncateTableRequest) (*pb.OkResponse, error) {
-	if query, err := truncateTableQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, truncateTableQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) Delete(ctx context.Context, request *pb.DeleteRequest) (*pb.OkResponse, error) {
-	if query, err := deleteQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, deleteQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) Update(ctx context.Context, request *pb.UpdateRequest) (*pb.OkResponse, error) {
-	if query, err := updateQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, updateQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) Insert(ctx context.Context, request *pb.InsertRequest) (*pb.OkResponse, error) {
-	if query, err := insertQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, insertQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) Select(ctx context.Context, request *pb.SelectRequest) (*pb.TableResponse, error) {
-	if query, err := selectQueryBuilder(request); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if data, err := s.queryQuery(ctx, query); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, selectQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if columns, rows, found_rows, err := s.queryFoundRows(ctx, request.GetTransactionId(), request.GetDatabaseName(), request.GetSelectData().GetCalcFoundRows(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else if rows, next_page_token, err := selectPage(request, columns, rows); err != nil {
+		return nil, execErrorStatus(err)
+	} else if response, err := tableResponse(request.GetResultFormat(), columns, rows); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.TableResponse{
-			Ok:   true,
-			Data: data,
-		}, nil
+		response.NextPageToken = next_page_token
+		response.FoundRows = found_rows
+		return response, nil
 	}
 }
 func (s *ApiServer) Join(ctx context.Context, request *pb.JoinRequest) (*pb.TableResponse, error) {
-	if query, err := joinQueryBuilder(request); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if data, err := s.queryQuery(ctx, query); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, joinQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.queryTable(ctx, request.GetTransactionId(), request.GetDatabaseName(), request.GetResultFormat(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.TableResponse{
-			Ok:   true,
-			Data: data,
-		}, nil
+		return response, nil
+	}
+}
+func (s *ApiServer) SelectStream(request *pb.SelectRequest, stream pb.Api_SelectStreamServer) error {
+	if selectPaginated(request) {
+		return buildErrorStatus(buildQueryError("stream can't be paginated"))
+	} else if query, args, err := buildQuery(request, selectQueryBuilder); err != nil {
+		return buildErrorStatus(err)
+	} else if err := s.streamRows(stream.Context(), request.GetTransactionId(), request.GetDatabaseName(), request.GetChunkSize(), stream.Send, query, args...); err != nil {
+		return execErrorStatus(err)
+	} else {
+		return nil
+	}
+}
+func (s *ApiServer) JoinStream(request *pb.JoinRequest, stream pb.Api_JoinStreamServer) error {
+	if query, args, err := buildQuery(request, joinQueryBuilder); err != nil {
+		return buildErrorStatus(err)
+	} else if err := s.streamRows(stream.Context(), request.GetTransactionId(), request.GetDatabaseName(), request.GetChunkSize(), stream.Send, query, args...); err != nil {
+		return execErrorStatus(err)
+	} else {
+		return nil
 	}
 }
 func (s *ApiServer) ShowDatabases(ctx context.Context, request *pb.ShowDatabasesRequest) (*pb.TableResponse, error) {
-	if query, err := showDatabasesQueryBuilder(request); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if data, err := s.queryQuery(ctx, query); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, showDatabasesQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.queryTable(ctx, request.GetTransactionId(), "", request.GetResultFormat(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.TableResponse{
-			Ok:   true,
-			Data: data,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) ShowTables(ctx context.Context, request *pb.ShowTablesRequest) (*pb.TableResponse, error) {
-	if query, err := showTablesQueryBuilder(request); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if data, err := s.queryQuery(ctx, query); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, showTablesQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.queryTable(ctx, request.GetTransactionId(), "", request.GetResultFormat(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.TableResponse{
-			Ok:   true,
-			Data: data,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) ShowTableStruct(ctx context.Context, request *pb.ShowTableStructRequest) (*pb.TableResponse, error) {
-	if query, err := showTableStructQueryBuilder(request); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if data, err := s.queryQuery(ctx, query); err != nil {
-		return &pb.TableResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, showTableStructQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.queryTable(ctx, request.GetTransactionId(), "", request.GetResultFormat(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.TableResponse{
-			Ok:   true,
-			Data: data,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) CreateTrigger(ctx context.Context, request *pb.CreateTriggerRequest) (*pb.OkResponse, error) {
-	if query, err := createTriggerQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, createTriggerQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) DropTrigger(ctx context.Context, request *pb.DropTriggerRequest) (*pb.OkResponse, error) {
-	if query, err := dropTriggerQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, dropTriggerQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) CreateView(ctx context.Context, request *pb.CreateViewRequest) (*pb.OkResponse, error) {
-	if query, err := createViewQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, createViewQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) AlterView(ctx context.Context, request *pb.AlterViewRequest) (*pb.OkResponse, error) {
-	if query, err := alterViewQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, alterViewQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) DropView(ctx context.Context, request *pb.DropViewRequest) (*pb.OkResponse, error) {
-	if query, err := dropViewQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, dropViewQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
+	}
+}
+func (s *ApiServer) CreateIndex(ctx context.Context, request *pb.CreateIndexRequest) (*pb.OkResponse, error) {
+	if query, args, err := buildQuery(request, createIndexQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return response, nil
+	}
+}
+func (s *ApiServer) DropIndex(ctx context.Context, request *pb.DropIndexRequest) (*pb.OkResponse, error) {
+	if query, args, err := buildQuery(request, dropIndexQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return response, nil
 	}
 }
 func (s *ApiServer) CallProcedure(ctx context.Context, request *pb.CallProcedureRequest) (*pb.OkResponse, error) {
-	if query, err := callProcedureQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, callProcedureQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execSessionQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), true, query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) CreateProcedure(ctx context.Context, request *pb.CreateProcedureRequest) (*pb.OkResponse, error) {
-	if query, err := createProcedureQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, createProcedureQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) DropProcedure(ctx context.Context, request *pb.DropProcedureRequest) (*pb.OkResponse, error) {
-	if query, err := dropProcedureQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
-		}, nil
+	if query, args, err := buildQuery(request, dropProcedureQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), query, args...); err != nil {
+		return nil, execErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
-		}, nil
+		return response, nil
 	}
 }
 func (s *ApiServer) Set(ctx context.Context, request *pb.SetRequest) (*pb.OkResponse, error) {
-	if query, err := setQueryBuilder(request); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A1, Message: err.Error()},
-		}, nil
-	} else if err := s.execQuery(ctx, query); err != nil {
-		return &pb.OkResponse{
-			Ok:    false,
-			Error: &pb.ResponseError{Code: 0x000000A2, Message: err.Error()},
+	if query, args, err := buildQuery(request, setQueryBuilder); err != nil {
+		return nil, buildErrorStatus(err)
+	} else if response, err := s.execSessionQuery(ctx, request.GetTransactionId(), request.GetDatabaseName(), true, query, args...); err != nil {
+		return nil, execErrorStatus(err)
+	} else {
+		return response, nil
+	}
+}
+func (s *ApiServer) Batch(ctx context.Context, request *pb.BatchRequest) (*pb.BatchResponse, error) {
+	if err := validateExecutedRequest(request); err != nil {
+		return nil, buildErrorStatus(err)
+	}
+	steps := make([]batchStep, 0, len(request.GetOperations()))
+	session_state := false
+	for i, operation := range request.GetOperations() {
+		if query, args, err := batchOperationQueryBuilder(operation); err != nil {
+			return nil, batchBuildErrorStatus(i, err)
+		} else {
+			steps = append(steps, batchStep{query: query, args: args})
+		}
+		if _, operation_request, _ := operationRequest(operation); leavesSessionState(operation_request) {
+			session_state = true
+		}
+	}
+	if results, failed_step, err := s.execBatch(ctx, request.GetTransactionId(), request.GetDatabaseName(), session_state, steps); err != nil {
+		return nil, batchExecErrorStatus(failed_step, results, err)
+	} else {
+		return &pb.BatchResponse{
+			Ok:         true,
+			FailedStep: -1,
+			Results:    results,
 		}, nil
+	}
+}
+func (s *ApiServer) RenderQuery(ctx context.Context, request *pb.RenderQueryRequest) (*pb.RenderQueryResponse, error) {
+	if query, params, err := renderOperation(request.GetOperation(), request.GetPretty()); err != nil {
+		return nil, buildErrorStatus(err)
 	} else {
-		return &pb.OkResponse{
-			Ok: true,
+		return &pb.RenderQueryResponse{
+			Ok:     true,
+			Query:  query,
+			Params: params,
 		}, nil
 	}
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	pb "greateapot.re/dblabs-api"
+)
+
+func newMockServer(t *testing.T) (*ApiServer, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to open mock db: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &ApiServer{DB: db, Transactions: newTransactionRegistry(db, 2)}, mock
+}
+
+func mockUserRows(mock sqlmock.Sqlmock) *sqlmock.Rows {
+	return mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("INT", int64(0)),
+		sqlmock.NewColumn("name").OfType("VARCHAR", ""),
+	)
+}
+
+func TestSelectRowOrderAndLimit(t *testing.T) {
+	s, mock := newMockServer(t)
+	request := &pb.SelectRequest{
+		SelectData: &pb.SelectData{TableName: "users", ColumnNames: []string{"id", "name"}, OrderBy: &pb.OrderBy{Expr: "id", OrderByDescending: true}, Limit: 2},
+	}
+	for _, format := range []pb.ResultFormat{pb.ResultFormat_ROWS, pb.ResultFormat_JSON} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT `id`, `name` FROM `users` ORDER BY id DESC LIMIT 2").
+			WillReturnRows(mockUserRows(mock).AddRow(int64(3), "c").AddRow(int64(2), "b"))
+		mock.ExpectCommit()
+
+		request.ResultFormat = format
+		response, err := s.Select(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Select: %s", err)
+		}
+		if format == pb.ResultFormat_JSON {
+			if response.GetData() != `[[3,"c"],[2,"b"]]` {
+				t.Errorf("Select data = %s", response.GetData())
+			}
+			continue
+		}
+		if len(response.GetRows()) != 2 {
+			t.Fatalf("Select returned %d rows, want 2", len(response.GetRows()))
+		}
+		for i, id := range []int64{3, 2} {
+			if value := response.GetRows()[i].GetValues()[0]; value.GetType() != pb.ValueType_VALUE_INT || value.GetIntValue() != id {
+				t.Errorf("row %d id = %v, want %d", i, value, id)
+			}
+		}
+		if columns := response.GetColumns(); len(columns) != 2 || columns[0].GetName() != "id" || columns[0].GetDatabaseType() != "INT" {
+			t.Errorf("Select columns = %v", columns)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryRowsKeepsOrder(t *testing.T) {
+	s, mock := newMockServer(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `name` FROM `users` ORDER BY `name` LIMIT 3").
+		WillReturnRows(mock.NewRows([]string{"name"}).AddRow("a").AddRow("b").AddRow("c"))
+	mock.ExpectCommit()
+
+	_, rows, err := s.queryRows(context.Background(), "", "", "SELECT `name` FROM `users` ORDER BY `name` LIMIT 3")
+	if err != nil {
+		t.Fatalf("queryRows: %s", err)
+	} else if len(rows) != 3 {
+		t.Fatalf("queryRows returned %d rows, want 3", len(rows))
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if value := rows[i].GetValues()[0].GetStringValue(); value != name {
+			t.Errorf("row %d = %q, want %q", i, value, name)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelectPagination(t *testing.T) {
+	s, mock := newMockServer(t)
+	// plain order by + limit isn't paginated, keys don't have to be selected
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `name` FROM `users` ORDER BY `id` LIMIT 1").
+		WillReturnRows(mock.NewRows([]string{"name"}).AddRow("a"))
+	mock.ExpectCommit()
+	request := &pb.SelectRequest{SelectData: &pb.SelectData{TableName: "users", ColumnNames: []string{"name"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}}
+	if response, err := s.Select(context.Background(), request); err != nil || response.GetNextPageToken() != "" || len(response.GetRows()) != 1 {
+		t.Errorf("Select = %v, %v", response, err)
+	}
+	// paginated one reads one extra row, which is cut off
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `id`, `name` FROM `users` ORDER BY `id` LIMIT 2").
+		WillReturnRows(mockUserRows(mock).AddRow(int64(1), "a").AddRow(int64(2), "b"))
+	mock.ExpectCommit()
+	request = &pb.SelectRequest{SelectData: &pb.SelectData{TableName: "users", ColumnNames: []string{"id", "name"}, OrderBy: &pb.OrderBy{ColumnNames: []string{"id"}}, Limit: 1}, Paginate: true}
+	if response, err := s.Select(context.Background(), request); err != nil || response.GetNextPageToken() == "" || len(response.GetRows()) != 1 {
+		t.Errorf("Select = %v, %v", response, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBatchRejectsConflictingOperations(t *testing.T) {
+	s, mock := newMockServer(t)
+	request := &pb.BatchRequest{
+		DatabaseName: "shop",
+		Operations: []*pb.Operation{
+			{Type: pb.OperationType_DELETE, Delete: &pb.DeleteRequest{TableName: "users", DatabaseName: "shop"}},
+			{Type: pb.OperationType_DELETE, Delete: &pb.DeleteRequest{TableName: "users", DatabaseName: "other", TransactionId: "tx"}},
+			{Type: pb.OperationType_CREATE_DATABASE, CreateDatabase: &pb.CreateDatabaseRequest{DatabaseName: "other"}},
+		},
+	}
+	err := validateRequest(request)
+	if err == nil || err.Error() != "invalid request: operations[1].delete.transaction_id: conflicts with batch transaction_id; operations[1].delete.database_name: conflicts with batch database_name" {
+		t.Errorf("validateRequest = %v", err)
+	}
+	if _, err := s.Batch(context.Background(), request); err == nil {
+		t.Errorf("Batch: want err")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Batch ran queries: %s", err)
+	}
+}
+
+func TestLockingReadRequiresTransaction(t *testing.T) {
+	s, _ := newMockServer(t)
+	locked := &pb.SelectData{TableName: "users", ColumnNames: []string{"id"}, LockingRead: &pb.LockingRead{Mode: pb.LockMode_FOR_UPDATE}}
+	request := &pb.SelectRequest{
+		SelectData: &pb.SelectData{
+			TableName:   "u",
+			ColumnNames: []string{"id"},
+			With:        &pb.WithClause{CommonTableExpressions: []*pb.CommonTableExpression{{Name: "u", SelectData: locked}}},
+			WhereExpr:   &pb.Expression{Type: pb.ExpressionType_EXISTS, Subquery: locked},
+		},
+	}
+	err := validateExecutedRequest(request)
+	if err == nil || err.Error() != "invalid request: select_data.with.common_table_expressions[0].select_data.locking_read: requires transaction_id; select_data.where_expr.subquery.locking_read: requires transaction_id" {
+		t.Errorf("validateExecutedRequest = %v", err)
+	}
+	if _, err := s.Select(context.Background(), request); err == nil {
+		t.Errorf("Select: want err")
+	}
+	request.TransactionId = "tx"
+	if err := validateExecutedRequest(request); err != nil {
+		t.Errorf("validateExecutedRequest in transaction = %s", err)
+	}
+	if _, err := s.RenderQuery(context.Background(), &pb.RenderQueryRequest{Operation: &pb.Operation{Type: pb.OperationType_SELECT, Select: &pb.SelectRequest{SelectData: locked}}}); err != nil {
+		t.Errorf("RenderQuery: %s", err)
+	}
+}
+
+func TestTemporaryTableRequiresTransaction(t *testing.T) {
+	s, mock := newMockServer(t)
+	request := &pb.CreateTableRequest{
+		TableName: "scratch",
+		Temporary: true,
+		Options:   []*pb.CreateTableOption{{Type: pb.CreateTableOptionType_COLUMN, Column: &pb.Column{ColumnName: "id", DataType: &pb.DataType{Type: pb.DataTypeType_INT}}}},
+	}
+	if err := validateExecutedRequest(request); err == nil || err.Error() != "invalid request: temporary: requires transaction_id" {
+		t.Errorf("validateExecutedRequest = %v", err)
+	}
+	batch := &pb.BatchRequest{Operations: []*pb.Operation{{Type: pb.OperationType_CREATE_TABLE, CreateTable: request}}}
+	if err := validateExecutedRequest(batch); err == nil || err.Error() != "invalid request: operations[0].create_table.temporary: requires transaction_id" {
+		t.Errorf("validateExecutedRequest of batch = %v", err)
+	}
+
+	mock.ExpectBegin()
+	transaction_id, err := s.Transactions.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	request.TransactionId = transaction_id
+	if err := validateExecutedRequest(request); err != nil {
+		t.Errorf("validateExecutedRequest in transaction = %s", err)
+	}
+	s.Transactions.markSessionState(transaction_id)
+	if !s.Transactions.transactions[transaction_id].session_state {
+		t.Errorf("markSessionState didn't mark transaction")
+	}
+}
+
+func TestSelectRejectsExpressionColumnNames(t *testing.T) {
+	request := &pb.SelectRequest{SelectData: &pb.SelectData{TableName: "users", ColumnNames: []string{"id", "COUNT(*)"}}}
+	if err := validateExecutedRequest(request); err == nil || !strings.Contains(err.Error(), "select_data.column_names[1]: invalid identifier \"COUNT(*)\"") {
+		t.Errorf("validateExecutedRequest = %v", err)
+	}
+}
+
+func mockExec(mock sqlmock.Sqlmock, query string) {
+	mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// sqlmock has a single conn per db, so each case uses own server.
+func TestSessionStatementsDiscardConn(t *testing.T) {
+	s, mock := newMockServer(t)
+	mock.ExpectBegin()
+	mockExec(mock, "DELETE FROM `users`")
+	mock.ExpectCommit()
+	if _, err := s.Delete(context.Background(), &pb.DeleteRequest{TableName: "users"}); err != nil {
+		t.Fatalf("Delete: %s", err)
+	} else if open := s.DB.Stats().OpenConnections; open != 1 {
+		t.Errorf("Delete: %d open conns, want conn back in pool", open)
+	}
+
+	s, mock = newMockServer(t)
+	mock.ExpectBegin()
+	mockExec(mock, "SET @x = 1")
+	mock.ExpectCommit()
+	if _, err := s.Set(context.Background(), &pb.SetRequest{VarName: "@x", Expr: "1"}); err != nil {
+		t.Fatalf("Set: %s", err)
+	} else if open := s.DB.Stats().OpenConnections; open != 0 {
+		t.Errorf("Set: %d open conns, want conn discarded", open)
+	}
+
+	s, mock = newMockServer(t)
+	mock.ExpectBegin()
+	transaction_id, err := s.Transactions.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	mockExec(mock, "SET @x = 1")
+	if _, err := s.Set(context.Background(), &pb.SetRequest{VarName: "@x", Expr: "1", TransactionId: transaction_id}); err != nil {
+		t.Fatalf("Set in transaction: %s", err)
+	}
+	mock.ExpectCommit()
+	if err := s.Transactions.finish(transaction_id, true); err != nil {
+		t.Fatalf("finish: %s", err)
+	} else if open := s.DB.Stats().OpenConnections; open != 0 {
+		t.Errorf("finish: %d open conns, want conn of transaction with Set discarded", open)
+	}
+}
+
+func TestExecResult(t *testing.T) {
+	defer func(collect_warnings bool) { SrvConf.CollectWarnings = collect_warnings }(SrvConf.CollectWarnings)
+	for _, collect_warnings := range []bool{false, true} {
+		SrvConf.CollectWarnings = collect_warnings
+		s, mock := newMockServer(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `users`").WillReturnResult(sqlmock.NewResult(7, 3))
+		if collect_warnings {
+			mock.ExpectQuery("SHOW WARNINGS").WillReturnRows(sqlmock.NewRows([]string{"Level", "Code", "Message"}).
+				AddRow("Warning", 1265, "Data truncated for column 'name' at row 1"))
+		}
+		mock.ExpectCommit()
+		response, err := s.Delete(context.Background(), &pb.DeleteRequest{TableName: "users"})
+		if err != nil {
+			t.Fatalf("Delete: %s", err)
+		} else if response.GetRowsAffected() != 3 || response.GetLastInsertId() != 7 {
+			t.Errorf("Delete = %v, want 3 rows affected, last insert id 7", response)
+		}
+		if warnings := response.GetWarnings(); collect_warnings && (len(warnings) != 1 || warnings[0].GetCode() != 1265 || warnings[0].GetLevel() != "Warning") {
+			t.Errorf("Delete warnings = %v, want data truncated", warnings)
+		} else if !collect_warnings && len(warnings) != 0 {
+			t.Errorf("Delete warnings = %v, want none when not collected", warnings)
+		}
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("collect_warnings %v: %s", collect_warnings, err)
+		}
+	}
+}
+
+func TestDatabaseNameResetsConn(t *testing.T) {
+	defer func(database_name string) { SrvConf.DatabaseName = database_name }(SrvConf.DatabaseName)
+	for _, tc := range []struct {
+		dsn_database_name string
+		want_open         int
+	}{
+		{"lab", 1}, // switched back, reused
+		{"", 0},    // can't be unset, discarded
+	} {
+		SrvConf.DatabaseName = tc.dsn_database_name
+		s, mock := newMockServer(t)
+		mockExec(mock, "USE `shop`")
+		mock.ExpectBegin()
+		mockExec(mock, "DELETE FROM `users`")
+		mock.ExpectCommit()
+		if tc.dsn_database_name != "" {
+			mockExec(mock, "USE `lab`")
+		}
+		if _, err := s.Delete(context.Background(), &pb.DeleteRequest{TableName: "users", DatabaseName: "shop"}); err != nil {
+			t.Fatalf("Delete: %s", err)
+		} else if open := s.DB.Stats().OpenConnections; open != tc.want_open {
+			t.Errorf("dsn db %q: %d open conns, want %d", tc.dsn_database_name, open, tc.want_open)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("dsn db %q: %s", tc.dsn_database_name, err)
+		}
+	}
+
+	// transaction conn is switched back when it finishes
+	SrvConf.DatabaseName = "lab"
+	s, mock := newMockServer(t)
+	mockExec(mock, "USE `shop`")
+	mock.ExpectBegin()
+	transaction_id, err := s.Transactions.begin(context.Background(), false, "shop")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	mock.ExpectCommit()
+	mockExec(mock, "USE `lab`")
+	if err = s.Transactions.finish(transaction_id, true); err != nil {
+		t.Fatalf("finish: %s", err)
+	} else if open := s.DB.Stats().OpenConnections; open != 1 {
+		t.Errorf("finish: %d open conns, want conn back in pool", open)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
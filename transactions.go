@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	errUnknownTransaction          = errors.New("unknown or expired transaction")
+	errTransactionDatabaseMismatch = errors.New("db doesn't match transaction db")
+	errTooManyTransactions         = errors.New("too many open transactions")
+	errTransactionAborted          = errors.New("transaction is aborted")
+)
+
+// transaction is client-controlled tx pinned to its own conn, requests carrying its id run on it.
+// Default database is chosen once on begin, since mysql can't unset it on conn.
+// Note: mysql commits implicitly on most DDL statements (CREATE/ALTER/DROP ...).
+type transaction struct {
+	mu sync.Mutex
+
+	conn          *sql.Conn
+	tx            *sql.Tx
+	database_name string
+	last_used     time.Time
+	session_state bool // session outlives tx (e.g. temporary table), so conn isn't reused
+}
+
+func (t *transaction) close() {
+	resetConn(t.conn, t.database_name, t.session_state)
+}
+
+// transactionRegistry holds open transactions. Their count is capped below the conn pool size,
+// so that abandoned ones can't take every conn from other requests until they expire.
+type transactionRegistry struct {
+	mu sync.Mutex
+
+	db           *sql.DB
+	transactions map[string]*transaction
+	slots        chan struct{} // one per open (or beginning) transaction
+}
+
+func newTransactionRegistry(db *sql.DB, max_transactions uint) *transactionRegistry {
+	return &transactionRegistry{db: db, transactions: map[string]*transaction{}, slots: make(chan struct{}, max_transactions)}
+}
+
+func (r *transactionRegistry) releaseSlot() {
+	<-r.slots
+}
+
+func newTransactionId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate transaction id, err: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (r *transactionRegistry) begin(ctx context.Context, read_only bool, database_name string) (transaction_id string, err error) {
+	if transaction_id, err = newTransactionId(); err != nil {
+		return "", err
+	}
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		return "", fmt.Errorf("%w (max %d)", errTooManyTransactions, cap(r.slots))
+	}
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		r.releaseSlot()
+		return "", fmt.Errorf("failed to get conn, err: %w", err)
+	}
+	if database_name != "" {
+		if err = useDatabase(ctx, conn, database_name); err != nil {
+			releaseConn(conn, true)
+			r.releaseSlot()
+			return "", err
+		}
+	}
+	// tx outlives the rpc, so it can't be bound to the request ctx
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: read_only})
+	if err != nil {
+		resetConn(conn, database_name, false)
+		r.releaseSlot()
+		return "", fmt.Errorf("failed begin tx, err: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transactions[transaction_id] = &transaction{conn: conn, tx: tx, database_name: database_name, last_used: time.Now()}
+	return transaction_id, nil
+}
+
+// run calls fn on tx of transaction_id, calls on the same transaction are serialized.
+// database_name must be empty or match the one transaction was begun with. fn runs on ctx of
+// the request: if it's done (driver kills the conn then) or conn is broken, transaction can't
+// go on, so it's aborted and removed.
+func (r *transactionRegistry) run(ctx context.Context, transaction_id string, database_name string, fn func(tx *sql.Tx) error) error {
+	r.mu.Lock()
+	t, ok := r.transactions[transaction_id]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %s", errUnknownTransaction, transaction_id)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx == nil { // finished while waiting for the lock
+		return fmt.Errorf("%w %s", errUnknownTransaction, transaction_id)
+	} else if database_name != "" && database_name != t.database_name {
+		return fmt.Errorf("%w: transaction %s uses db %q, not %q", errTransactionDatabaseMismatch, transaction_id, t.database_name, database_name)
+	}
+	defer func() { t.last_used = time.Now() }()
+	err := fn(t.tx)
+	if err != nil && (ctx.Err() != nil || errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)) {
+		log.Printf("Transaction %s conn is broken, aborting it, err: %s", transaction_id, err.Error())
+		r.mu.Lock()
+		if r.transactions[transaction_id] == t {
+			delete(r.transactions, transaction_id)
+		}
+		r.mu.Unlock()
+		t.tx.Rollback()
+		t.tx = nil
+		t.session_state = true // conn is discarded
+		t.close()
+		r.releaseSlot()
+		return fmt.Errorf("%w %s: %w", errTransactionAborted, transaction_id, err)
+	}
+	return err
+}
+
+// markSessionState makes transaction_id discard its conn when it finishes, for statements which leave
+// session state behind. Unknown transaction_id is ignored, run reports it.
+func (r *transactionRegistry) markSessionState(transaction_id string) {
+	r.mu.Lock()
+	t, ok := r.transactions[transaction_id]
+	r.mu.Unlock()
+	if ok {
+		t.mu.Lock()
+		t.session_state = true
+		t.mu.Unlock()
+	}
+}
+
+// finish removes transaction_id from registry and commits or rolls back its tx.
+func (r *transactionRegistry) finish(transaction_id string, commit bool) (err error) {
+	r.mu.Lock()
+	t, ok := r.transactions[transaction_id]
+	delete(r.transactions, transaction_id)
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %s", errUnknownTransaction, transaction_id)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx == nil { // aborted by run while waiting for the lock
+		return fmt.Errorf("%w %s", errUnknownTransaction, transaction_id)
+	}
+	defer r.releaseSlot()
+	defer t.close()
+	if commit {
+		if err = t.tx.Commit(); err != nil {
+			err = fmt.Errorf("failed to commit changes, err: %w", err)
+		}
+	} else if err = t.tx.Rollback(); err != nil {
+		err = fmt.Errorf("failed to rollback changes, err: %w", err)
+	}
+	t.tx = nil
+	return
+}
+
+// expire rolls back transactions which are idle for longer than idle_timeout, busy ones are skipped.
+func (r *transactionRegistry) expire(idle_timeout time.Duration) {
+	// expired ones are taken out (and kept locked) under r.mu, but rolled back after it's released,
+	// so slow rollback doesn't block other transactions
+	expired := map[string]*transaction{}
+	r.mu.Lock()
+	for transaction_id, t := range r.transactions {
+		if !t.mu.TryLock() {
+			continue
+		}
+		if time.Since(t.last_used) > idle_timeout {
+			delete(r.transactions, transaction_id)
+			expired[transaction_id] = t
+		} else {
+			t.mu.Unlock()
+		}
+	}
+	r.mu.Unlock()
+	for transaction_id, t := range expired {
+		log.Printf("Transaction %s is idle for more than %s, rolling back", transaction_id, idle_timeout)
+		t.tx.Rollback()
+		t.tx = nil
+		t.close()
+		r.releaseSlot()
+		t.mu.Unlock()
+	}
+}
+
+func (r *transactionRegistry) runJanitor(idle_timeout time.Duration) {
+	ticker := time.NewTicker(idle_timeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.expire(idle_timeout)
+	}
+}
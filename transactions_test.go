@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockRegistry(t *testing.T, max_transactions uint) (*transactionRegistry, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock db: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newTransactionRegistry(db, max_transactions), mock
+}
+
+func TestTransactionBeginRunFinish(t *testing.T) {
+	r, mock := newMockRegistry(t, 2)
+	mock.ExpectBegin()
+	transaction_id, err := r.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	ran := false
+	if err = r.run(context.Background(), transaction_id, "", func(tx *sql.Tx) error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("run = %v, ran %v", err, ran)
+	}
+	if err = r.run(context.Background(), transaction_id, "other", func(tx *sql.Tx) error { return nil }); !errors.Is(err, errTransactionDatabaseMismatch) {
+		t.Errorf("run with other db = %v, want db mismatch", err)
+	}
+	mock.ExpectCommit()
+	if err = r.finish(transaction_id, true); err != nil {
+		t.Errorf("finish: %s", err)
+	}
+	if err = r.finish(transaction_id, true); !errors.Is(err, errUnknownTransaction) {
+		t.Errorf("second finish = %v, want unknown transaction", err)
+	}
+	if err = r.run(context.Background(), transaction_id, "", func(tx *sql.Tx) error { return nil }); !errors.Is(err, errUnknownTransaction) {
+		t.Errorf("run after finish = %v, want unknown transaction", err)
+	}
+	if len(r.slots) != 0 {
+		t.Errorf("%d slots taken after finish, want 0", len(r.slots))
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransactionSlots(t *testing.T) {
+	r, mock := newMockRegistry(t, 1)
+	mock.ExpectBegin()
+	transaction_id, err := r.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	if _, err = r.begin(context.Background(), false, ""); !errors.Is(err, errTooManyTransactions) {
+		t.Errorf("begin over limit = %v, want too many transactions", err)
+	}
+	mock.ExpectRollback()
+	if err = r.finish(transaction_id, false); err != nil {
+		t.Fatalf("finish: %s", err)
+	}
+	mock.ExpectBegin()
+	if _, err = r.begin(context.Background(), false, ""); err != nil {
+		t.Errorf("begin after finish: %s", err)
+	}
+}
+
+func TestTransactionExpire(t *testing.T) {
+	r, mock := newMockRegistry(t, 2)
+	mock.ExpectBegin()
+	transaction_id, err := r.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	r.expire(time.Minute)
+	if _, ok := r.transactions[transaction_id]; !ok {
+		t.Fatalf("expire removed transaction which isn't idle")
+	}
+
+	// busy transaction is skipped even if its last use is too old
+	r.transactions[transaction_id].last_used = time.Now().Add(-time.Hour)
+	running, release, done := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		done <- r.run(context.Background(), transaction_id, "", func(tx *sql.Tx) error {
+			close(running)
+			<-release
+			return nil
+		})
+	}()
+	<-running
+	r.expire(time.Minute)
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatalf("run: %s", err)
+	}
+	if _, ok := r.transactions[transaction_id]; !ok {
+		t.Fatalf("expire removed busy transaction")
+	}
+
+	r.transactions[transaction_id].last_used = time.Now().Add(-time.Hour)
+	mock.ExpectRollback()
+	r.expire(time.Minute)
+	if _, ok := r.transactions[transaction_id]; ok {
+		t.Errorf("expire kept idle transaction")
+	} else if len(r.slots) != 0 {
+		t.Errorf("%d slots taken after expire, want 0", len(r.slots))
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransactionRunAbortsBrokenConn(t *testing.T) {
+	for name, run := range map[string]func(r *transactionRegistry, transaction_id string) error{
+		"bad conn": func(r *transactionRegistry, transaction_id string) error {
+			return r.run(context.Background(), transaction_id, "", func(tx *sql.Tx) error { return driver.ErrBadConn })
+		},
+		"cancelled": func(r *transactionRegistry, transaction_id string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return r.run(ctx, transaction_id, "", func(tx *sql.Tx) error { return ctx.Err() })
+		},
+	} {
+		r, mock := newMockRegistry(t, 1)
+		mock.ExpectBegin()
+		transaction_id, err := r.begin(context.Background(), false, "")
+		if err != nil {
+			t.Fatalf("%s: begin: %s", name, err)
+		}
+		mock.ExpectRollback()
+		if err = run(r, transaction_id); !errors.Is(err, errTransactionAborted) {
+			t.Errorf("%s: run = %v, want aborted transaction", name, err)
+		}
+		if _, ok := r.transactions[transaction_id]; ok {
+			t.Errorf("%s: aborted transaction is still registered", name)
+		} else if len(r.slots) != 0 {
+			t.Errorf("%s: %d slots taken after abort, want 0", name, len(r.slots))
+		}
+		if err = r.finish(transaction_id, true); !errors.Is(err, errUnknownTransaction) {
+			t.Errorf("%s: finish of aborted transaction = %v, want unknown transaction", name, err)
+		}
+	}
+}
+
+func TestTransactionRunKeepsTransactionOnQueryError(t *testing.T) {
+	r, mock := newMockRegistry(t, 1)
+	mock.ExpectBegin()
+	transaction_id, err := r.begin(context.Background(), false, "")
+	if err != nil {
+		t.Fatalf("begin: %s", err)
+	}
+	query_err := errors.New("duplicate entry")
+	if err = r.run(context.Background(), transaction_id, "", func(tx *sql.Tx) error { return query_err }); err != query_err {
+		t.Errorf("run = %v, want query err as is", err)
+	}
+	if _, ok := r.transactions[transaction_id]; !ok {
+		t.Errorf("query error removed transaction")
+	}
+}
@@ -0,0 +1,1131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "greateapot.re/dblabs-api"
+)
+
+type fieldViolation struct {
+	field       string // proto field path, e.g. options[2].add_column.column.data_type
+	description string
+}
+
+// validationError holds every violation found in request, unlike builder errors which stop at the first one.
+type validationError struct {
+	violations []fieldViolation
+}
+
+func (e *validationError) Error() string {
+	violations := make([]string, 0, len(e.violations))
+	for _, violation := range e.violations {
+		violations = append(violations, violation.field+": "+violation.description)
+	}
+	return "invalid request: " + strings.Join(violations, "; ")
+}
+
+type validator struct {
+	violations []fieldViolation
+}
+
+func (v *validator) fail(field string, format string, a ...any) {
+	v.violations = append(v.violations, fieldViolation{field, fmt.Sprintf(format, a...)})
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &validationError{v.violations}
+}
+
+func fieldPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// required fails field if it's not present, returns present.
+func (v *validator) required(field string, present bool) bool {
+	if !present {
+		v.fail(field, "required")
+	}
+	return present
+}
+
+func (v *validator) identifier(field string, name string, quote func(string) (string, error), required bool) {
+	if name == "" {
+		if required {
+			v.fail(field, "required")
+		}
+	} else if _, err := quote(name); err != nil {
+		v.fail(field, "%s", err.Error())
+	}
+}
+
+func (v *validator) identifierList(field string, names []string, quote func(string) (string, error), required bool) {
+	if len(names) == 0 {
+		if required {
+			v.fail(field, "required")
+		}
+	}
+	for i, name := range names {
+		v.identifier(indexPath(field, i), name, quote, true)
+	}
+}
+
+func (v *validator) condition(path string, condition_field string, condition string, params_field string, params []*pb.Value, expr_field string, expr *pb.Expression) {
+	if expr != nil {
+		if condition != "" || len(params) > 0 {
+			v.fail(fieldPath(path, expr_field), "mutually exclusive with %s and %s", condition_field, params_field)
+		}
+		v.expression(fieldPath(path, expr_field), expr)
+		return
+	}
+	if placeholders := countPlaceholders(condition); placeholders != len(params) {
+		v.fail(fieldPath(path, params_field), "%d placeholders in %s, but %d params passed", placeholders, condition_field, len(params))
+	}
+	for i, param := range params {
+		if _, err := valueParam(param); err != nil {
+			v.fail(indexPath(fieldPath(path, params_field), i), "%s", err.Error())
+		}
+	}
+}
+
+func (v *validator) expression(path string, expr *pb.Expression) {
+	if !v.required(path, expr != nil) {
+		return
+	} else if _, ok := pb.ExpressionType_name[int32(expr.GetType())]; !ok {
+		v.fail(fieldPath(path, "type"), "unknown expression type")
+		return
+	}
+	if min_operands, max_operands := expressionOperandCount(expr); len(expr.GetOperands()) < min_operands || (max_operands != -1 && len(expr.GetOperands()) > max_operands) {
+		v.fail(fieldPath(path, "operands"), "wrong operand count %d for %s expression", len(expr.GetOperands()), expr.GetType().String())
+	}
+	for i, operand := range expr.GetOperands() {
+		v.expression(indexPath(fieldPath(path, "operands"), i), operand)
+	}
+	switch expr.GetType() {
+	case pb.ExpressionType_COLUMN:
+		v.identifier(fieldPath(path, "column_name"), expr.GetColumnName(), quoteOperandColumnName, true)
+	case pb.ExpressionType_LITERAL:
+		if expr.GetValue().GetType() == pb.ValueType_VALUE_DEFAULT {
+			v.fail(fieldPath(path, "value"), "DEFAULT isn't allowed in expression")
+		} else {
+			v.value(fieldPath(path, "value"), expr.GetValue())
+		}
+	case pb.ExpressionType_COMPARISON:
+		if _, ok := comparisonOperators[expr.GetOperator()]; !ok {
+			v.fail(fieldPath(path, "operator"), "unknown comparison operator")
+		}
+	case pb.ExpressionType_FUNCTION:
+		if !isFunctionName(expr.GetFunctionName()) {
+			v.fail(fieldPath(path, "function_name"), "invalid function name %q", expr.GetFunctionName())
+		}
+	case pb.ExpressionType_SUBQUERY, pb.ExpressionType_EXISTS:
+		v.selectData(fieldPath(path, "subquery"), expr.GetSubquery())
+	case pb.ExpressionType_IN:
+		if expr.GetSubquery() != nil {
+			v.selectData(fieldPath(path, "subquery"), expr.GetSubquery())
+		}
+	}
+}
+
+func (v *validator) value(path string, value *pb.Value) {
+	if !v.required(path, value != nil) {
+		return
+	}
+	switch value.GetType() {
+	case pb.ValueType_VALUE_DEFAULT, pb.ValueType_VALUE_NULL:
+	case pb.ValueType_VALUE_EXPR:
+		if v.required(fieldPath(path, "expr"), value.GetExpr() != "") && countPlaceholders(value.GetExpr()) != 0 {
+			v.fail(fieldPath(path, "expr"), "can't contain placeholders")
+		}
+	default:
+		if _, err := valueParam(value); err != nil {
+			v.fail(fieldPath(path, "type"), "%s", err.Error())
+		}
+	}
+}
+
+func (v *validator) valueList(path string, value_list *pb.ValueList) {
+	if !v.required(path, value_list != nil) {
+		return
+	}
+	v.required(fieldPath(path, "values"), len(value_list.GetValues()) > 0)
+	for i, value := range value_list.GetValues() {
+		v.value(indexPath(fieldPath(path, "values"), i), value)
+	}
+}
+
+func (v *validator) rowConstructorList(path string, row_constructor_list *pb.RowConstructorList) {
+	if !v.required(path, row_constructor_list != nil) {
+		return
+	}
+	v.required(fieldPath(path, "value_list"), len(row_constructor_list.GetValueList()) > 0)
+	for i, value_list := range row_constructor_list.GetValueList() {
+		v.valueList(indexPath(fieldPath(path, "value_list"), i), value_list)
+	}
+}
+
+func (v *validator) assignmentList(path string, assignment_list *pb.AssignmentList) {
+	if !v.required(path, assignment_list != nil) {
+		return
+	}
+	v.required(fieldPath(path, "assignments"), len(assignment_list.GetAssignments()) > 0)
+	for i, assignment := range assignment_list.GetAssignments() {
+		assignment_path := indexPath(fieldPath(path, "assignments"), i)
+		v.identifier(fieldPath(assignment_path, "column_name"), assignment.GetColumnName(), quoteColumnName, true)
+		v.value(fieldPath(assignment_path, "value"), assignment.GetValue())
+	}
+}
+
+func (v *validator) orderBy(path string, order_by *pb.OrderBy) {
+	if order_by == nil {
+		return // optional everywhere
+	} else if len(order_by.GetColumnNames()) > 0 {
+		v.identifierList(fieldPath(path, "column_names"), order_by.GetColumnNames(), quoteColumnName, true)
+	} else {
+		v.required(fieldPath(path, "expr"), order_by.GetExpr() != "")
+	}
+}
+
+func (v *validator) selectData(path string, select_data *pb.SelectData) {
+	if !v.required(path, select_data != nil) {
+		return
+	}
+	v.selectExpr(path, select_data.GetColumnNames(), select_data.GetSelectItems())
+	window_names := map[string]bool{}
+	for i, named_window := range select_data.GetWindows() {
+		window_path := indexPath(fieldPath(path, "windows"), i)
+		if !v.required(window_path, named_window != nil) {
+			continue
+		}
+		v.identifier(fieldPath(window_path, "name"), named_window.GetName(), quoteIdentifier, true)
+		if window_names[named_window.GetName()] {
+			v.fail(fieldPath(window_path, "name"), "duplicate window name %q", named_window.GetName())
+		}
+		window_names[named_window.GetName()] = true
+		v.windowSpec(fieldPath(window_path, "window"), named_window.GetWindow())
+	}
+	v.identifier(fieldPath(path, "table_name"), select_data.GetTableName(), quoteSchemaObjectName, false)
+	if locking_read := select_data.GetLockingRead(); locking_read != nil {
+		locking_read_path := fieldPath(path, "locking_read")
+		if _, ok := pb.LockMode_name[int32(locking_read.GetMode())]; !ok {
+			v.fail(fieldPath(locking_read_path, "mode"), "unknown lock mode")
+		}
+		if _, ok := pb.LockWaitPolicy_name[int32(locking_read.GetWaitPolicy())]; !ok {
+			v.fail(fieldPath(locking_read_path, "wait_policy"), "unknown lock wait policy")
+		}
+		v.identifierList(fieldPath(locking_read_path, "table_names"), locking_read.GetTableNames(), quoteIdentifier, false)
+	}
+	if select_data.GetWith() != nil {
+		v.with(fieldPath(path, "with"), select_data.GetWith())
+	}
+	v.condition(path, "where_condition", select_data.GetWhereCondition(), "where_params", select_data.GetWhereParams(), "where_expr", select_data.GetWhereExpr())
+	v.condition(path, "having_condition", select_data.GetHavingCondition(), "having_params", select_data.GetHavingParams(), "having_expr", select_data.GetHavingExpr())
+	v.orderBy(fieldPath(path, "order_by"), select_data.GetOrderBy())
+}
+
+// selectExpr validates select list of path, either column_names or select_items.
+func (v *validator) selectExpr(path string, column_names []string, select_items []*pb.SelectItem) {
+	if len(select_items) == 0 {
+		v.identifierList(fieldPath(path, "column_names"), column_names, quoteSelectColumnName, true)
+	} else if len(column_names) > 0 {
+		v.fail(fieldPath(path, "select_items"), "mutually exclusive with column_names")
+	}
+	for i, select_item := range select_items {
+		v.selectItem(indexPath(fieldPath(path, "select_items"), i), select_item)
+	}
+}
+
+func (v *validator) selectItem(path string, select_item *pb.SelectItem) {
+	if !v.required(path, select_item != nil) {
+		return
+	}
+	switch select_item.GetType() {
+	case pb.SelectItemType_COLUMN:
+		v.identifier(fieldPath(path, "column_name"), select_item.GetColumnName(), quoteSelectColumnName, true)
+	case pb.SelectItemType_EXPR:
+		v.required(fieldPath(path, "expr"), select_item.GetExpr() != "")
+	case pb.SelectItemType_WINDOW_FUNCTION:
+		v.windowFunction(fieldPath(path, "window_function"), select_item.GetWindowFunction())
+	default:
+		v.fail(fieldPath(path, "type"), "unknown select item type")
+	}
+	v.identifier(fieldPath(path, "alias"), select_item.GetAlias(), quoteIdentifier, false)
+}
+
+func (v *validator) windowFunction(path string, window_function *pb.WindowFunction) {
+	if !v.required(path, window_function != nil) {
+		return
+	} else if _, ok := pb.WindowFunctionType_name[int32(window_function.GetType())]; !ok {
+		v.fail(fieldPath(path, "type"), "unknown window function type")
+	} else if min_args, max_args := windowFunctionArgCount(window_function.GetType()); len(window_function.GetArgs()) < min_args || len(window_function.GetArgs()) > max_args {
+		v.fail(fieldPath(path, "args"), "%s takes %d to %d args", window_function.GetType().String(), min_args, max_args)
+	}
+	if window_function.GetWindowName() != "" {
+		v.identifier(fieldPath(path, "window_name"), window_function.GetWindowName(), quoteIdentifier, true)
+		if window_function.GetWindow() != nil {
+			v.fail(fieldPath(path, "window"), "mutually exclusive with window_name")
+		}
+	} else if window_function.GetWindow() != nil {
+		v.windowSpec(fieldPath(path, "window"), window_function.GetWindow())
+	}
+}
+
+func (v *validator) windowSpec(path string, window_spec *pb.WindowSpec) {
+	if window_spec == nil {
+		return // OVER ()
+	}
+	v.identifier(fieldPath(path, "base_window_name"), window_spec.GetBaseWindowName(), quoteIdentifier, false)
+	v.orderBy(fieldPath(path, "order_by"), window_spec.GetOrderBy())
+	if frame := window_spec.GetFrame(); frame != nil {
+		frame_path := fieldPath(path, "frame")
+		if _, ok := pb.WindowFrameUnits_name[int32(frame.GetUnits())]; !ok {
+			v.fail(fieldPath(frame_path, "units"), "unknown frame units")
+		}
+		if v.required(fieldPath(frame_path, "start"), frame.GetStart() != nil) {
+			v.windowFrameBound(fieldPath(frame_path, "start"), frame.GetUnits(), frame.GetStart())
+		}
+		if frame.GetEnd() != nil {
+			v.windowFrameBound(fieldPath(frame_path, "end"), frame.GetUnits(), frame.GetEnd())
+		}
+	}
+}
+
+func (v *validator) windowFrameBound(path string, units pb.WindowFrameUnits, bound *pb.WindowFrameBound) {
+	switch bound.GetType() {
+	case pb.WindowFrameBoundType_UNBOUNDED_PRECEDING, pb.WindowFrameBoundType_UNBOUNDED_FOLLOWING, pb.WindowFrameBoundType_CURRENT_ROW:
+	case pb.WindowFrameBoundType_PRECEDING, pb.WindowFrameBoundType_FOLLOWING:
+		if !v.required(fieldPath(path, "expr"), bound.GetExpr() != "") || isFrameBoundExpr(units, bound.GetExpr()) {
+			return
+		} else if units == pb.WindowFrameUnits_RANGE {
+			v.fail(fieldPath(path, "expr"), "RANGE frame bound must be unsigned number or INTERVAL")
+		} else {
+			v.fail(fieldPath(path, "expr"), "ROWS frame bound must be unsigned integer")
+		}
+	default:
+		v.fail(fieldPath(path, "type"), "unknown frame bound type")
+	}
+}
+
+func (v *validator) with(path string, with *pb.WithClause) {
+	ctes_path := fieldPath(path, "common_table_expressions")
+	if !v.required(ctes_path, len(with.GetCommonTableExpressions()) > 0) {
+		return
+	}
+	cte_names := map[string]bool{}
+	for i, cte := range with.GetCommonTableExpressions() {
+		cte_path := indexPath(ctes_path, i)
+		if !v.required(cte_path, cte != nil) {
+			continue
+		}
+		v.identifier(fieldPath(cte_path, "name"), cte.GetName(), quoteIdentifier, true)
+		if cte_names[cte.GetName()] {
+			v.fail(fieldPath(cte_path, "name"), "duplicate cte name %q", cte.GetName())
+		}
+		cte_names[cte.GetName()] = true
+		v.identifierList(fieldPath(cte_path, "column_names"), cte.GetColumnNames(), quoteIdentifier, false)
+		v.selectStatement(cte_path, cte.GetSelectData(), cte.GetCompoundSelect())
+	}
+}
+
+func (v *validator) compoundSelect(path string, compound_select *pb.CompoundSelect) {
+	if !v.required(path, compound_select != nil) {
+		return
+	}
+	if len(compound_select.GetOperands()) < 2 {
+		v.fail(fieldPath(path, "operands"), "at least 2 operands required")
+	}
+	for i, operand := range compound_select.GetOperands() {
+		operand_path := indexPath(fieldPath(path, "operands"), i)
+		if !v.required(operand_path, operand != nil) {
+			continue
+		} else if _, ok := pb.SetOperationType_name[int32(operand.GetSetOperation())]; i > 0 && !ok {
+			v.fail(fieldPath(operand_path, "set_operation"), "unknown set operation type")
+		}
+		v.selectData(fieldPath(operand_path, "select_data"), operand.GetSelectData())
+	}
+	v.orderBy(fieldPath(path, "order_by"), compound_select.GetOrderBy())
+}
+
+// selectStatement validates select source of requests which take either select data or compound select.
+func (v *validator) selectStatement(path string, select_data *pb.SelectData, compound_select *pb.CompoundSelect) {
+	if compound_select == nil {
+		v.selectData(fieldPath(path, "select_data"), select_data)
+	} else if select_data != nil {
+		v.fail(fieldPath(path, "compound_select"), "mutually exclusive with select_data")
+	} else {
+		v.compoundSelect(fieldPath(path, "compound_select"), compound_select)
+	}
+}
+
+// pagination checks paginated select before it runs: keys are read from result cols of the last row.
+func (v *validator) pagination(path string, request *pb.SelectRequest) {
+	field := "paginate"
+	if request.GetPageToken() != "" {
+		field = "page_token"
+	}
+	if request.GetCompoundSelect() != nil {
+		v.fail(fieldPath(path, field), "compound select can't be paginated")
+		return
+	}
+	select_data := request.GetSelectData()
+	v.required(fieldPath(path, "select_data.limit"), select_data.GetLimit() != 0)
+	keys_path := fieldPath(path, "select_data.order_by.column_names")
+	if !v.required(keys_path, len(select_data.GetOrderBy().GetColumnNames()) > 0) {
+		return
+	}
+	for i, key := range select_data.GetOrderBy().GetColumnNames() {
+		if !pageKeySelected(select_data, key) {
+			v.fail(indexPath(keys_path, i), "must be selected (without alias) to be paginated")
+		}
+	}
+	if request.GetPageToken() != "" {
+		if _, err := decodePageToken(select_data, request.GetPageToken()); err != nil {
+			v.fail(fieldPath(path, "page_token"), "%s", err.Error())
+		}
+	}
+}
+
+func (v *validator) dataType(path string, data_type *pb.DataType) {
+	if !v.required(path, data_type != nil) {
+		return
+	} else if _, ok := pb.DataTypeType_name[int32(data_type.GetType())]; !ok {
+		v.fail(fieldPath(path, "type"), "unknown data type")
+	} else if data_type.GetType() == pb.DataTypeType_ENUM {
+		v.required(fieldPath(path, "enum_attrs.values"), len(data_type.GetEnumAttrs().GetValues()) > 0)
+	}
+}
+
+func (v *validator) column(path string, column *pb.Column) {
+	if !v.required(path, column != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "column_name"), column.GetColumnName(), quoteIdentifier, true)
+	v.dataType(fieldPath(path, "data_type"), column.GetDataType())
+	v.identifier(fieldPath(path, "collate"), column.GetCollate(), quoteIdentifier, false)
+	if column.GetNotNull() && column.GetNull() {
+		v.fail(fieldPath(path, "null"), "mutually exclusive with not_null")
+	}
+	if column.GetDefaultValue() != nil {
+		v.defaultValue(fieldPath(path, "default_value"), column.GetDefaultValue())
+	}
+	if column.GetOnUpdateCurrentTimestamp() {
+		if data_type := column.GetDataType().GetType(); data_type != pb.DataTypeType_TIMESTAMP && data_type != pb.DataTypeType_DATETIME {
+			v.fail(fieldPath(path, "on_update_current_timestamp"), "requires TIMESTAMP or DATETIME col")
+		}
+	}
+	if generated := column.GetGenerated(); generated != nil {
+		v.required(fieldPath(path, "generated.expr"), generated.GetExpr() != "")
+		if column.GetDefaultValue() != nil || column.GetOnUpdateCurrentTimestamp() || column.GetDataType().GetIntAttrs().GetAutoIncrement() {
+			v.fail(fieldPath(path, "generated"), "generated col can't have default, on update or auto increment")
+		}
+	}
+}
+
+func (v *validator) defaultValue(path string, default_value *pb.DefaultValue) {
+	set := 0
+	for _, is_set := range []bool{default_value.GetValue() != "", default_value.GetExpr() != "", default_value.GetLiteral() != nil} {
+		if is_set {
+			set++
+		}
+	}
+	if set == 0 {
+		v.fail(path, "one of value, expr or literal required")
+	} else if set > 1 {
+		v.fail(path, "value, expr and literal are mutually exclusive")
+	} else if literal := default_value.GetLiteral(); literal != nil {
+		if literal.GetType() == pb.ValueType_VALUE_DEFAULT {
+			v.fail(fieldPath(path, "literal"), "DEFAULT isn't allowed as default value")
+		} else {
+			v.value(fieldPath(path, "literal"), literal)
+		}
+	}
+}
+
+func (v *validator) insertColumn(path string, insert *pb.InsertColumn) {
+	if insert != nil && insert.GetType() == pb.InsertColumnType_AFTER {
+		v.identifier(fieldPath(path, "after_column_name"), insert.GetAfterColumnName(), quoteIdentifier, true)
+	}
+}
+
+func (v *validator) primaryKey(path string, pk *pb.PrimaryKey) {
+	if !v.required(path, pk != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "constraint_symbol"), pk.GetConstraintSymbol(), quoteIdentifier, false)
+	v.identifierList(fieldPath(path, "key_parts"), pk.GetKeyParts(), quoteIdentifier, true)
+}
+
+func (v *validator) uniqueKey(path string, uk *pb.UniqueKey) {
+	if !v.required(path, uk != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "constraint_symbol"), uk.GetConstraintSymbol(), quoteIdentifier, false)
+	v.identifierList(fieldPath(path, "key_parts"), uk.GetKeyParts(), quoteIdentifier, true)
+}
+
+func (v *validator) check(path string, check *pb.Check) {
+	if !v.required(path, check != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "constraint_symbol"), check.GetConstraintSymbol(), quoteIdentifier, false)
+	if check.GetConditionExpr() != nil {
+		if check.GetCondition() != "" {
+			v.fail(fieldPath(path, "condition_expr"), "mutually exclusive with condition")
+		}
+		v.expression(fieldPath(path, "condition_expr"), check.GetConditionExpr())
+	} else if v.required(fieldPath(path, "condition"), check.GetCondition() != "") && countPlaceholders(check.GetCondition()) != 0 {
+		v.fail(fieldPath(path, "condition"), "can't contain placeholders")
+	}
+}
+
+func (v *validator) foreignKey(path string, fk *pb.ForeignKey) {
+	if !v.required(path, fk != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "constraint_symbol"), fk.GetConstraintSymbol(), quoteIdentifier, false)
+	v.identifierList(fieldPath(path, "column_names"), fk.GetColumnNames(), quoteIdentifier, true)
+	v.identifier(fieldPath(path, "parent_table_name"), fk.GetParentTableName(), quoteSchemaObjectName, true)
+	v.identifierList(fieldPath(path, "parent_key_parts"), fk.GetParentKeyParts(), quoteIdentifier, true)
+	if len(fk.GetParentKeyParts()) > 0 && len(fk.GetColumnNames()) != len(fk.GetParentKeyParts()) {
+		v.fail(fieldPath(path, "parent_key_parts"), "must have as many parts as column_names")
+	}
+	v.identifier(fieldPath(path, "index_name"), fk.GetIndexName(), quoteIdentifier, false)
+	if _, ok := pb.ForeignKeyMatch_name[int32(fk.GetMatch())]; !ok {
+		v.fail(fieldPath(path, "match"), "unknown fk match type")
+	} else if fk.GetMatch() != pb.ForeignKeyMatch_MATCH_DEFAULT && (fk.GetOnDelete() != pb.ReferenceOption_REFERENCE_DEFAULT || fk.GetOnUpdate() != pb.ReferenceOption_REFERENCE_DEFAULT) {
+		// https://dev.mysql.com/doc/refman/8.0/en/create-table-foreign-keys.html
+		v.fail(fieldPath(path, "match"), "explicit MATCH makes mysql ignore ON DELETE and ON UPDATE")
+	}
+	if _, ok := pb.ReferenceOption_name[int32(fk.GetOnDelete())]; !ok {
+		v.fail(fieldPath(path, "on_delete"), "unknown reference option")
+	}
+	if _, ok := pb.ReferenceOption_name[int32(fk.GetOnUpdate())]; !ok {
+		v.fail(fieldPath(path, "on_update"), "unknown reference option")
+	}
+}
+
+func (v *validator) index(path string, index *pb.Index, name_required bool) {
+	if !v.required(path, index != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "index_name"), index.GetIndexName(), quoteIdentifier, name_required)
+	if _, ok := pb.IndexType_name[int32(index.GetType())]; !ok {
+		v.fail(fieldPath(path, "type"), "unknown index type")
+	}
+	if v.required(fieldPath(path, "key_parts"), len(index.GetKeyParts()) > 0) {
+		for i, key_part := range index.GetKeyParts() {
+			key_part_path := indexPath(fieldPath(path, "key_parts"), i)
+			if v.required(key_part_path, key_part != nil) {
+				v.identifier(fieldPath(key_part_path, "column_name"), key_part.GetColumnName(), quoteIdentifier, true)
+			}
+		}
+	}
+	// https://dev.mysql.com/doc/refman/8.0/en/create-index.html
+	switch index.GetType() {
+	case pb.IndexType_SPATIAL:
+		if len(index.GetKeyParts()) != 1 || index.GetKeyParts()[0].GetLength() != 0 {
+			v.fail(fieldPath(path, "key_parts"), "spatial index takes single key part without length")
+		}
+	case pb.IndexType_FULLTEXT:
+		for i, key_part := range index.GetKeyParts() {
+			if key_part.GetLength() != 0 || key_part.GetDescending() {
+				v.fail(indexPath(fieldPath(path, "key_parts"), i), "fulltext index key part can't have length or DESC")
+			}
+		}
+	}
+	if index_options := index.GetOptions(); index_options != nil {
+		if _, ok := pb.IndexUsing_name[int32(index_options.GetUsing())]; !ok {
+			v.fail(fieldPath(path, "options.using"), "unknown index using type")
+		} else if index_options.GetUsing() != pb.IndexUsing_USING_DEFAULT && (index.GetType() == pb.IndexType_FULLTEXT || index.GetType() == pb.IndexType_SPATIAL) {
+			v.fail(fieldPath(path, "options.using"), "isn't supported by %s index", index.GetType().String())
+		}
+		if index_options.GetParser() != "" && index.GetType() != pb.IndexType_FULLTEXT {
+			v.fail(fieldPath(path, "options.parser"), "is supported only by FULLTEXT index")
+		}
+		v.identifier(fieldPath(path, "options.parser"), index_options.GetParser(), quoteIdentifier, false)
+	}
+}
+
+func (v *validator) indexAlgorithmLock(path string, algorithm pb.IndexAlgorithm, lock pb.IndexLock) {
+	if _, ok := pb.IndexAlgorithm_name[int32(algorithm)]; !ok {
+		v.fail(fieldPath(path, "algorithm"), "unknown index algorithm")
+	}
+	if _, ok := pb.IndexLock_name[int32(lock)]; !ok {
+		v.fail(fieldPath(path, "lock"), "unknown index lock")
+	}
+}
+
+func (v *validator) alterTableOption(path string, option *pb.AlterTableOption) {
+	if !v.required(path, option != nil) {
+		return
+	}
+	switch option.GetType() {
+	case pb.AlterTableOptionType_ADD_COLUMN:
+		if v.required(fieldPath(path, "add_column"), option.GetAddColumn() != nil) {
+			v.column(fieldPath(path, "add_column.column"), option.GetAddColumn().GetColumn())
+			v.insertColumn(fieldPath(path, "add_column.insert"), option.GetAddColumn().GetInsert())
+		}
+	case pb.AlterTableOptionType_ADD_PRIMARY_KEY:
+		if v.required(fieldPath(path, "add_primary_key"), option.GetAddPrimaryKey() != nil) {
+			v.primaryKey(fieldPath(path, "add_primary_key.primary_key"), option.GetAddPrimaryKey().GetPrimaryKey())
+		}
+	case pb.AlterTableOptionType_ADD_UNIQUE_KEY:
+		if v.required(fieldPath(path, "add_unique_key"), option.GetAddUniqueKey() != nil) {
+			v.uniqueKey(fieldPath(path, "add_unique_key.unique_key"), option.GetAddUniqueKey().GetUniqueKey())
+		}
+	case pb.AlterTableOptionType_ADD_FOREIGN_KEY:
+		if v.required(fieldPath(path, "add_foreign_key"), option.GetAddForeignKey() != nil) {
+			v.foreignKey(fieldPath(path, "add_foreign_key.foreign_key"), option.GetAddForeignKey().GetForeignKey())
+		}
+	case pb.AlterTableOptionType_CHANGE:
+		if v.required(fieldPath(path, "change"), option.GetChange() != nil) {
+			v.identifier(fieldPath(path, "change.old_column_name"), option.GetChange().GetOldColumnName(), quoteIdentifier, true)
+			v.column(fieldPath(path, "change.new_column"), option.GetChange().GetNewColumn())
+			v.insertColumn(fieldPath(path, "change.insert"), option.GetChange().GetInsert())
+		}
+	case pb.AlterTableOptionType_DROP_COLUMN:
+		if v.required(fieldPath(path, "drop_column"), option.GetDropColumn() != nil) {
+			v.identifier(fieldPath(path, "drop_column.column_name"), option.GetDropColumn().GetColumnName(), quoteIdentifier, true)
+		}
+	case pb.AlterTableOptionType_DROP_PRIMARY_KEY:
+		v.required(fieldPath(path, "drop_primary_key"), option.GetDropPrimaryKey() != nil)
+	case pb.AlterTableOptionType_DROP_FOREIGN_KEY:
+		if v.required(fieldPath(path, "drop_foreign_key"), option.GetDropForeignKey() != nil) {
+			v.identifier(fieldPath(path, "drop_foreign_key.foreign_key_symbol"), option.GetDropForeignKey().GetForeignKeySymbol(), quoteIdentifier, true)
+		}
+	case pb.AlterTableOptionType_MODIFY:
+		if v.required(fieldPath(path, "modify"), option.GetModify() != nil) {
+			v.column(fieldPath(path, "modify.column"), option.GetModify().GetColumn())
+			v.insertColumn(fieldPath(path, "modify.insert"), option.GetModify().GetInsert())
+		}
+	case pb.AlterTableOptionType_ORDER:
+		v.identifierList(fieldPath(path, "order.column_names"), option.GetOrder().GetColumnNames(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_RENAME_COLUMN:
+		if v.required(fieldPath(path, "rename_column"), option.GetRenameColumn() != nil) {
+			v.identifier(fieldPath(path, "rename_column.old_column_name"), option.GetRenameColumn().GetOldColumnName(), quoteIdentifier, true)
+			v.identifier(fieldPath(path, "rename_column.new_column_name"), option.GetRenameColumn().GetNewColumnName(), quoteIdentifier, true)
+		}
+	case pb.AlterTableOptionType_RENAME:
+		v.identifier(fieldPath(path, "rename.new_table_name"), option.GetRename().GetNewTableName(), quoteSchemaObjectName, true)
+	case pb.AlterTableOptionType_DROP_KEY:
+		v.identifier(fieldPath(path, "drop_key.key_name"), option.GetDropKey().GetKeyName(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_ADD_INDEX:
+		if v.required(fieldPath(path, "add_index"), option.GetAddIndex() != nil) {
+			v.index(fieldPath(path, "add_index.index"), option.GetAddIndex().GetIndex(), false)
+		}
+	case pb.AlterTableOptionType_DROP_INDEX:
+		v.identifier(fieldPath(path, "drop_index.index_name"), option.GetDropIndex().GetIndexName(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_ALTER_INDEX:
+		v.identifier(fieldPath(path, "alter_index.index_name"), option.GetAlterIndex().GetIndexName(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_ADD_CHECK:
+		if v.required(fieldPath(path, "add_check"), option.GetAddCheck() != nil) {
+			v.check(fieldPath(path, "add_check.check"), option.GetAddCheck().GetCheck())
+		}
+	case pb.AlterTableOptionType_DROP_CHECK:
+		v.identifier(fieldPath(path, "drop_check.constraint_symbol"), option.GetDropCheck().GetConstraintSymbol(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_ALTER_CHECK:
+		v.identifier(fieldPath(path, "alter_check.constraint_symbol"), option.GetAlterCheck().GetConstraintSymbol(), quoteIdentifier, true)
+	case pb.AlterTableOptionType_TABLE_OPTIONS:
+		if v.required(fieldPath(path, "table_options"), option.GetTableOptions() != nil) {
+			v.tableOptions(fieldPath(path, "table_options"), option.GetTableOptions())
+		}
+	case pb.AlterTableOptionType_ALTER_COLUMN:
+		if v.required(fieldPath(path, "alter_column"), option.GetAlterColumn() != nil) {
+			alter_column := option.GetAlterColumn()
+			v.identifier(fieldPath(path, "alter_column.column_name"), alter_column.GetColumnName(), quoteIdentifier, true)
+			switch alter_column.GetType() {
+			case pb.AlterColumnType_SET_DEFAULT_VALUE:
+				if v.required(fieldPath(path, "alter_column.new_default_value"), alter_column.GetNewDefaultValue() != nil) {
+					v.defaultValue(fieldPath(path, "alter_column.new_default_value"), alter_column.GetNewDefaultValue())
+				}
+			case pb.AlterColumnType_DROP_DEFAULT_VALUE:
+			default:
+				v.fail(fieldPath(path, "alter_column.type"), "unknown alter col type")
+			}
+		}
+	default:
+		v.fail(fieldPath(path, "type"), "unknown option type")
+	}
+}
+
+func (v *validator) tableOptions(path string, table_options *pb.TableOptions) {
+	v.identifier(fieldPath(path, "engine"), table_options.GetEngine(), quoteIdentifier, false)
+	v.identifier(fieldPath(path, "charset"), table_options.GetCharset(), quoteIdentifier, false)
+	v.identifier(fieldPath(path, "collate"), table_options.GetCollate(), quoteIdentifier, false)
+	if _, ok := pb.RowFormat_name[int32(table_options.GetRowFormat())]; !ok {
+		v.fail(fieldPath(path, "row_format"), "unknown row format")
+	}
+	if table_options.GetEngine() == "" && table_options.GetCharset() == "" && table_options.GetCollate() == "" && table_options.GetAutoIncrement() == 0 &&
+		table_options.GetRowFormat() == pb.RowFormat_ROW_FORMAT_DEFAULT && table_options.GetComment() == "" && table_options.GetKeyBlockSize() == 0 {
+		v.fail(path, "table options is empty")
+	}
+}
+
+func (v *validator) createTableOption(path string, option *pb.CreateTableOption) {
+	if !v.required(path, option != nil) {
+		return
+	}
+	switch option.GetType() {
+	case pb.CreateTableOptionType_COLUMN:
+		v.column(fieldPath(path, "column"), option.GetColumn())
+	case pb.CreateTableOptionType_PRIMARY_KEY:
+		v.primaryKey(fieldPath(path, "primary_key"), option.GetPrimaryKey())
+	case pb.CreateTableOptionType_UNIQUE_KEY:
+		v.uniqueKey(fieldPath(path, "unique_key"), option.GetUniqueKey())
+	case pb.CreateTableOptionType_FOREIGN_KEY:
+		v.foreignKey(fieldPath(path, "foreign_key"), option.GetForeignKey())
+	case pb.CreateTableOptionType_AS:
+		v.identifier(fieldPath(path, "as.name"), option.GetAs().GetName(), quoteSchemaObjectName, true)
+	case pb.CreateTableOptionType_LIKE:
+		v.identifier(fieldPath(path, "like.name"), option.GetLike().GetName(), quoteSchemaObjectName, true)
+	case pb.CreateTableOptionType_CHECK:
+		v.check(fieldPath(path, "check"), option.GetCheck())
+	default:
+		v.fail(fieldPath(path, "type"), "unknown option type")
+	}
+}
+
+func (v *validator) join(path string, join *pb.Join) {
+	if !v.required(path, join != nil) {
+		return
+	}
+	switch join.GetJoinType() {
+	case pb.JoinType_INNER, pb.JoinType_CROSS:
+	case pb.JoinType_LEFT, pb.JoinType_RIGHT:
+		v.required(fieldPath(path, "join_specification"), join.GetJoinSpecification() != nil)
+	case pb.JoinType_NATURAL, pb.JoinType_NATURAL_LEFT, pb.JoinType_NATURAL_RIGHT:
+		if join.GetJoinSpecification() != nil {
+			v.fail(fieldPath(path, "join_specification"), "isn't allowed for natural join")
+		}
+	case pb.JoinType_STRAIGHT:
+		if join.GetJoinSpecification().GetType() == pb.JoinSpecificationType_USING {
+			v.fail(fieldPath(path, "join_specification.type"), "straight join supports only on")
+		}
+	case pb.JoinType_FULL:
+		if v.required(fieldPath(path, "join_specification"), join.GetJoinSpecification() != nil) && join.GetJoinSpecification().GetType() != pb.JoinSpecificationType_ON {
+			v.fail(fieldPath(path, "join_specification.type"), "full join supports only on")
+		}
+	default:
+		v.fail(fieldPath(path, "join_type"), "unknown join type")
+	}
+	if join_specification := join.GetJoinSpecification(); join_specification != nil {
+		specification_path := fieldPath(path, "join_specification")
+		switch join_specification.GetType() {
+		case pb.JoinSpecificationType_ON:
+			if join_specification.GetSearchExpr() == nil {
+				v.required(fieldPath(specification_path, "search_condition"), join_specification.GetSearchCondition() != "")
+			} else if join_specification.GetSearchCondition() != "" {
+				v.fail(fieldPath(specification_path, "search_expr"), "mutually exclusive with search_condition")
+			} else {
+				v.expression(fieldPath(specification_path, "search_expr"), join_specification.GetSearchExpr())
+			}
+		case pb.JoinSpecificationType_USING:
+			v.identifierList(fieldPath(specification_path, "join_column_list.column_names"), join_specification.GetJoinColumnList().GetColumnNames(), quoteIdentifier, true)
+		}
+	}
+}
+
+func (v *validator) joinClause(path string, join_clause *pb.JoinClause) {
+	if !v.required(path, join_clause != nil) {
+		return
+	}
+	v.identifier(fieldPath(path, "table_name"), join_clause.GetTableName(), quoteSchemaObjectName, true)
+	v.identifier(fieldPath(path, "table_alias"), join_clause.GetTableAlias(), quoteIdentifier, false)
+	v.join(fieldPath(path, "join"), join_clause.GetJoin())
+}
+
+func (v *validator) procedureParameter(path string, pp *pb.ProcedureParameter) {
+	if !v.required(path, pp != nil) {
+		return
+	} else if _, ok := pb.ProcedureParameterType_name[int32(pp.GetType())]; !ok {
+		v.fail(fieldPath(path, "type"), "unknown procedure parameter type")
+	}
+	v.identifier(fieldPath(path, "param_name"), pp.GetParamName(), quoteIdentifier, true)
+	v.dataType(fieldPath(path, "data_type"), pp.GetDataType())
+}
+
+// request validates every known request message (and Operation) at path.
+func (v *validator) request(path string, request any) {
+	switch r := request.(type) {
+	case *pb.AlterDatabaseRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, true)
+	case *pb.AlterTableRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.required(fieldPath(path, "options"), len(r.GetOptions()) > 0)
+		for i, option := range r.GetOptions() {
+			v.alterTableOption(indexPath(fieldPath(path, "options"), i), option)
+		}
+	case *pb.CreateDatabaseRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, true)
+	case *pb.CreateTableRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.required(fieldPath(path, "options"), len(r.GetOptions()) > 0)
+		for i, option := range r.GetOptions() {
+			v.createTableOption(indexPath(fieldPath(path, "options"), i), option)
+		}
+		if r.GetTableOptions() != nil {
+			v.tableOptions(fieldPath(path, "table_options"), r.GetTableOptions())
+		}
+	case *pb.DropDatabaseRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, true)
+	case *pb.DropTableRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+	case *pb.RenameTableRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "old_table_name"), r.GetOldTableName(), quoteSchemaObjectName, true)
+		v.identifier(fieldPath(path, "new_table_name"), r.GetNewTableName(), quoteSchemaObjectName, true)
+	case *pb.TruncateTableRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+	case *pb.DeleteRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.identifier(fieldPath(path, "table_alias"), r.GetTableAlias(), quoteIdentifier, false)
+		v.condition(path, "where_condition", r.GetWhereCondition(), "where_params", r.GetWhereParams(), "where_expr", r.GetWhereExpr())
+		v.orderBy(fieldPath(path, "order_by"), r.GetOrderBy())
+	case *pb.UpdateRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.assignmentList(fieldPath(path, "assignment_list"), r.GetAssignmentList())
+		v.condition(path, "where_condition", r.GetWhereCondition(), "where_params", r.GetWhereParams(), "where_expr", r.GetWhereExpr())
+		v.orderBy(fieldPath(path, "order_by"), r.GetOrderBy())
+	case *pb.InsertRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.identifierList(fieldPath(path, "column_names"), r.GetColumnNames(), quoteIdentifier, false)
+		switch r.GetInsertType() {
+		case pb.InsertType_SELECT:
+			v.selectStatement(path, r.GetSelectData(), r.GetCompoundSelect())
+		case pb.InsertType_TABLE:
+			v.identifier(fieldPath(path, "other_table_name"), r.GetOtherTableName(), quoteSchemaObjectName, true)
+		case pb.InsertType_VALUES:
+			v.rowConstructorList(fieldPath(path, "row_constructor_list"), r.GetRowConstructorList())
+		default:
+			v.fail(fieldPath(path, "insert_type"), "unknown insert type")
+		}
+		if r.GetOnDuplicateKeyUpdate() != nil {
+			v.assignmentList(fieldPath(path, "on_duplicate_key_update"), r.GetOnDuplicateKeyUpdate())
+		}
+	case *pb.SelectRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.selectStatement(path, r.GetSelectData(), r.GetCompoundSelect())
+		if selectPaginated(r) {
+			v.pagination(path, r)
+		}
+	case *pb.JoinRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.selectExpr(path, r.GetColumnNames(), r.GetSelectItems())
+		v.identifier(fieldPath(path, "first_table_name"), r.GetFirstTableName(), quoteSchemaObjectName, true)
+		v.identifier(fieldPath(path, "first_table_alias"), r.GetFirstTableAlias(), quoteIdentifier, false)
+		if r.GetSecondTableName() != "" || r.GetJoin() != nil {
+			v.identifier(fieldPath(path, "second_table_name"), r.GetSecondTableName(), quoteSchemaObjectName, true)
+			v.identifier(fieldPath(path, "second_table_alias"), r.GetSecondTableAlias(), quoteIdentifier, false)
+			v.join(fieldPath(path, "join"), r.GetJoin())
+		} else {
+			v.required(fieldPath(path, "join_clauses"), len(r.GetJoinClauses()) > 0)
+		}
+		for i, join_clause := range r.GetJoinClauses() {
+			v.joinClause(indexPath(fieldPath(path, "join_clauses"), i), join_clause)
+		}
+		is_legacy_join := r.GetSecondTableName() != "" || r.GetJoin() != nil
+		if is_legacy_join && r.GetJoin().GetJoinType() == pb.JoinType_FULL && len(r.GetJoinClauses()) > 0 {
+			v.fail(fieldPath(path, "join.join_type"), "full join must be the only join clause")
+		}
+		for i, join_clause := range r.GetJoinClauses() {
+			if join_clause.GetJoin().GetJoinType() == pb.JoinType_FULL && (is_legacy_join || len(r.GetJoinClauses()) > 1) {
+				v.fail(fieldPath(indexPath(fieldPath(path, "join_clauses"), i), "join.join_type"), "full join must be the only join clause")
+			}
+		}
+		is_full_join := r.GetJoin().GetJoinType() == pb.JoinType_FULL
+		for _, join_clause := range r.GetJoinClauses() {
+			is_full_join = is_full_join || join_clause.GetJoin().GetJoinType() == pb.JoinType_FULL
+		}
+		if is_full_join && (r.GetGroupByExpr() != "" || r.GetHavingCondition() != "" || r.GetHavingExpr() != nil) {
+			v.fail(fieldPath(path, "group_by_expr"), "group by and having aren't supported with full join")
+		}
+		v.condition(path, "where_condition", r.GetWhereCondition(), "where_params", r.GetWhereParams(), "where_expr", r.GetWhereExpr())
+		v.condition(path, "having_condition", r.GetHavingCondition(), "having_params", r.GetHavingParams(), "having_expr", r.GetHavingExpr())
+		v.orderBy(fieldPath(path, "order_by"), r.GetOrderBy())
+		if is_full_join {
+			// order by of the union can only refer to result column names
+			for i, column_name := range r.GetOrderBy().GetColumnNames() {
+				if parts, err := splitQualifiedIdentifier(column_name); err == nil && len(parts) > 1 {
+					v.fail(indexPath(fieldPath(path, "order_by.column_names"), i), "full join is ordered by result col names, %q is qualified", column_name)
+				}
+			}
+		}
+	case *pb.ShowDatabasesRequest:
+	case *pb.ShowTablesRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, true)
+	case *pb.ShowTableStructRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, true)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteIdentifier, true)
+	case *pb.CreateTriggerRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "trigger_name"), r.GetTriggerName(), quoteSchemaObjectName, true)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.required(fieldPath(path, "trigger_body"), r.GetTriggerBody() != "")
+		if r.GetTriggerOrder() != nil {
+			v.identifier(fieldPath(path, "trigger_order.other_trigger_name"), r.GetTriggerOrder().GetOtherTriggerName(), quoteIdentifier, true)
+		}
+	case *pb.DropTriggerRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "trigger_name"), r.GetTriggerName(), quoteSchemaObjectName, true)
+	case *pb.CreateViewRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "view_name"), r.GetViewName(), quoteSchemaObjectName, true)
+		v.selectStatement(path, r.GetSelectData(), r.GetCompoundSelect())
+		v.identifierList(fieldPath(path, "column_list"), r.GetColumnList(), quoteIdentifier, false)
+	case *pb.AlterViewRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "view_name"), r.GetViewName(), quoteSchemaObjectName, true)
+		v.selectStatement(path, r.GetSelectData(), r.GetCompoundSelect())
+		v.identifierList(fieldPath(path, "column_list"), r.GetColumnList(), quoteIdentifier, false)
+	case *pb.DropViewRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "view_name"), r.GetViewName(), quoteSchemaObjectName, true)
+	case *pb.CreateIndexRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.index(fieldPath(path, "index"), r.GetIndex(), true)
+		v.indexAlgorithmLock(path, r.GetAlgorithm(), r.GetLock())
+	case *pb.DropIndexRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "table_name"), r.GetTableName(), quoteSchemaObjectName, true)
+		v.identifier(fieldPath(path, "index_name"), r.GetIndexName(), quoteIdentifier, true)
+		v.indexAlgorithmLock(path, r.GetAlgorithm(), r.GetLock())
+	case *pb.CreateProcedureRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "procedure_name"), r.GetProcedureName(), quoteSchemaObjectName, true)
+		v.required(fieldPath(path, "routine_body"), r.GetRoutineBody() != "")
+		for i, pp := range r.GetProcedureParameters() {
+			v.procedureParameter(indexPath(fieldPath(path, "procedure_parameters"), i), pp)
+		}
+	case *pb.DropProcedureRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.identifier(fieldPath(path, "procedure_name"), r.GetProcedureName(), quoteSchemaObjectName, true)
+	case *pb.SetRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.required(fieldPath(path, "var_name"), r.GetVarName() != "")
+		v.required(fieldPath(path, "expr"), r.GetExpr() != "")
+	case *pb.CallProcedureRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.required(fieldPath(path, "expr"), r.GetExpr() != "")
+	case *pb.BeginTransactionRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+	case *pb.BatchRequest:
+		v.identifier(fieldPath(path, "database_name"), r.GetDatabaseName(), quoteIdentifier, false)
+		v.required(fieldPath(path, "operations"), len(r.GetOperations()) > 0)
+		for i, operation := range r.GetOperations() {
+			v.operation(indexPath(fieldPath(path, "operations"), i), operation)
+			v.batchOperation(indexPath(fieldPath(path, "operations"), i), operation, r)
+		}
+	case *pb.Operation:
+		v.operation(path, r)
+	}
+}
+
+// operationRequest returns request of operation and its field name, field is "" for unknown operation type.
+func operationRequest(operation *pb.Operation) (field string, request any, present bool) {
+	switch operation.GetType() {
+	case pb.OperationType_ALTER_DATABASE:
+		return "alter_database", operation.GetAlterDatabase(), operation.GetAlterDatabase() != nil
+	case pb.OperationType_ALTER_TABLE:
+		return "alter_table", operation.GetAlterTable(), operation.GetAlterTable() != nil
+	case pb.OperationType_CREATE_DATABASE:
+		return "create_database", operation.GetCreateDatabase(), operation.GetCreateDatabase() != nil
+	case pb.OperationType_CREATE_TABLE:
+		return "create_table", operation.GetCreateTable(), operation.GetCreateTable() != nil
+	case pb.OperationType_DROP_DATABASE:
+		return "drop_database", operation.GetDropDatabase(), operation.GetDropDatabase() != nil
+	case pb.OperationType_DROP_TABLE:
+		return "drop_table", operation.GetDropTable(), operation.GetDropTable() != nil
+	case pb.OperationType_RENAME_TABLE:
+		return "rename_table", operation.GetRenameTable(), operation.GetRenameTable() != nil
+	case pb.OperationType_TRUNCATE_TABLE:
+		return "truncate_table", operation.GetTruncateTable(), operation.GetTruncateTable() != nil
+	case pb.OperationType_DELETE:
+		return "delete", operation.GetDelete(), operation.GetDelete() != nil
+	case pb.OperationType_UPDATE:
+		return "update", operation.GetUpdate(), operation.GetUpdate() != nil
+	case pb.OperationType_INSERT:
+		return "insert", operation.GetInsert(), operation.GetInsert() != nil
+	case pb.OperationType_CREATE_TRIGGER:
+		return "create_trigger", operation.GetCreateTrigger(), operation.GetCreateTrigger() != nil
+	case pb.OperationType_DROP_TRIGGER:
+		return "drop_trigger", operation.GetDropTrigger(), operation.GetDropTrigger() != nil
+	case pb.OperationType_CREATE_VIEW:
+		return "create_view", operation.GetCreateView(), operation.GetCreateView() != nil
+	case pb.OperationType_ALTER_VIEW:
+		return "alter_view", operation.GetAlterView(), operation.GetAlterView() != nil
+	case pb.OperationType_DROP_VIEW:
+		return "drop_view", operation.GetDropView(), operation.GetDropView() != nil
+	case pb.OperationType_CREATE_PROCEDURE:
+		return "create_procedure", operation.GetCreateProcedure(), operation.GetCreateProcedure() != nil
+	case pb.OperationType_DROP_PROCEDURE:
+		return "drop_procedure", operation.GetDropProcedure(), operation.GetDropProcedure() != nil
+	case pb.OperationType_CALL_PROCEDURE:
+		return "call_procedure", operation.GetCallProcedure(), operation.GetCallProcedure() != nil
+	case pb.OperationType_SET:
+		return "set", operation.GetSet(), operation.GetSet() != nil
+	case pb.OperationType_CREATE_INDEX:
+		return "create_index", operation.GetCreateIndex(), operation.GetCreateIndex() != nil
+	case pb.OperationType_DROP_INDEX:
+		return "drop_index", operation.GetDropIndex(), operation.GetDropIndex() != nil
+	case pb.OperationType_SELECT:
+		return "select", operation.GetSelect(), operation.GetSelect() != nil
+	case pb.OperationType_JOIN:
+		return "join", operation.GetJoin(), operation.GetJoin() != nil
+	case pb.OperationType_SHOW_DATABASES:
+		return "show_databases", operation.GetShowDatabases(), true // all fields are optional
+	case pb.OperationType_SHOW_TABLES:
+		return "show_tables", operation.GetShowTables(), operation.GetShowTables() != nil
+	case pb.OperationType_SHOW_TABLE_STRUCT:
+		return "show_table_struct", operation.GetShowTableStruct(), operation.GetShowTableStruct() != nil
+	}
+	return "", nil, false
+}
+
+// operationNamesDatabase reports whether database_name of operation is its target, not the default db.
+func operationNamesDatabase(operation *pb.Operation) bool {
+	switch operation.GetType() {
+	case pb.OperationType_ALTER_DATABASE, pb.OperationType_CREATE_DATABASE, pb.OperationType_DROP_DATABASE:
+		return true
+	default:
+		return false
+	}
+}
+
+func (v *validator) operation(path string, operation *pb.Operation) {
+	if !v.required(path, operation != nil) {
+		return
+	}
+	field, request, present := operationRequest(operation)
+	if field == "" {
+		v.fail(fieldPath(path, "type"), "unknown operation type")
+	} else if v.required(fieldPath(path, field), present) {
+		v.request(fieldPath(path, field), request)
+	}
+}
+
+// batchOperation rejects row returning operations, and transaction_id and database_name of batch operation
+// which differ from batch ones: steps run in the batch tx on the batch db, so they would be ignored.
+// Database operations name their target db in database_name, it isn't checked.
+func (v *validator) batchOperation(path string, operation *pb.Operation, batch *pb.BatchRequest) {
+	field, request, present := operationRequest(operation)
+	if field == "" || !present {
+		return
+	}
+	switch operation.GetType() {
+	case pb.OperationType_SELECT, pb.OperationType_JOIN, pb.OperationType_SHOW_DATABASES, pb.OperationType_SHOW_TABLES, pb.OperationType_SHOW_TABLE_STRUCT:
+		v.fail(fieldPath(path, "type"), "operation type %s returns rows, it isn't allowed in batch", operation.GetType().String())
+		return
+	}
+	if r, ok := request.(interface{ GetTransactionId() string }); ok && r.GetTransactionId() != "" && r.GetTransactionId() != batch.GetTransactionId() {
+		v.fail(fieldPath(fieldPath(path, field), "transaction_id"), "conflicts with batch transaction_id")
+	}
+	if operationNamesDatabase(operation) {
+		return
+	}
+	if r, ok := request.(interface{ GetDatabaseName() string }); ok && r.GetDatabaseName() != "" && r.GetDatabaseName() != batch.GetDatabaseName() {
+		v.fail(fieldPath(fieldPath(path, field), "database_name"), "conflicts with batch database_name")
+	}
+}
+
+// execution checks rules of request which apply only when it runs (in transaction_id, "" for implicit tx),
+// not when it's rendered.
+func (v *validator) execution(path string, request any, transaction_id string) {
+	switch r := request.(type) {
+	case *pb.CreateTableRequest:
+		// temporary table lives as long as session, conn of client transaction is discarded after it
+		if r.GetTemporary() && transaction_id == "" {
+			v.fail(fieldPath(path, "temporary"), "requires transaction_id")
+		}
+	case *pb.SelectRequest:
+		// locks are held until the end of tx, in implicit one it's the end of the request
+		if transaction_id == "" {
+			v.lockingReads(path, r.GetSelectData(), r.GetCompoundSelect())
+		}
+	case *pb.BatchRequest:
+		for i, operation := range r.GetOperations() {
+			if field, request, present := operationRequest(operation); present {
+				v.execution(fieldPath(indexPath(fieldPath(path, "operations"), i), field), request, transaction_id)
+			}
+		}
+	}
+}
+
+// lockingReads rejects locking reads of select statement, including nested ones (ctes, compound select
+// operands and subqueries).
+func (v *validator) lockingReads(path string, select_data *pb.SelectData, compound_select *pb.CompoundSelect) {
+	if compound_select == nil {
+		v.selectDataLockingReads(fieldPath(path, "select_data"), select_data)
+		return
+	}
+	for i, operand := range compound_select.GetOperands() {
+		v.selectDataLockingReads(fieldPath(indexPath(fieldPath(path, "compound_select.operands"), i), "select_data"), operand.GetSelectData())
+	}
+}
+
+func (v *validator) selectDataLockingReads(path string, select_data *pb.SelectData) {
+	if select_data == nil {
+		return
+	} else if select_data.GetLockingRead() != nil {
+		v.fail(fieldPath(path, "locking_read"), "requires transaction_id")
+	}
+	for i, cte := range select_data.GetWith().GetCommonTableExpressions() {
+		v.lockingReads(indexPath(fieldPath(path, "with.common_table_expressions"), i), cte.GetSelectData(), cte.GetCompoundSelect())
+	}
+	v.expressionLockingReads(fieldPath(path, "where_expr"), select_data.GetWhereExpr())
+	v.expressionLockingReads(fieldPath(path, "having_expr"), select_data.GetHavingExpr())
+}
+
+func (v *validator) expressionLockingReads(path string, expr *pb.Expression) {
+	if expr == nil {
+		return
+	}
+	for i, operand := range expr.GetOperands() {
+		v.expressionLockingReads(indexPath(fieldPath(path, "operands"), i), operand)
+	}
+	v.selectDataLockingReads(fieldPath(path, "subquery"), expr.GetSubquery())
+}
+
+// validateRequest collects all violations of request before any sql is built.
+func validateRequest(request any) error {
+	v := &validator{}
+	v.request("", request)
+	return v.err()
+}
+
+// validateExecutedRequest is validateRequest of request which is going to run, see execution.
+func validateExecutedRequest(request any) error {
+	v := &validator{}
+	v.request("", request)
+	if r, ok := request.(interface{ GetTransactionId() string }); ok {
+		v.execution("", request, r.GetTransactionId())
+	} else {
+		v.execution("", request, "")
+	}
+	return v.err()
+}
+
+// buildQuery validates request which is going to run and builds it with builder.
+func buildQuery[R any](request R, builder func(R) (string, []any, error)) (query string, args []any, err error) {
+	if err = validateExecutedRequest(request); err != nil {
+		return "", nil, err
+	}
+	return builder(request)
+}